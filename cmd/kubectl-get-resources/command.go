@@ -0,0 +1,534 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// options holds the command-line flags shared by every command.
+type options struct {
+	namespaces                       namespaceList
+	namespacesFrom                   string
+	excludeCluster                   bool
+	includeCluster                   bool
+	includeNamespaced                bool
+	onlyCluster, onlyNamespaced      bool
+	kubeconfig                       string
+	kubeContexts                     stringList
+	insecureSkipTLSVerify            bool
+	certificateAuthority             string
+	asUser                           string
+	asGroups                         stringList
+	timeout                          time.Duration
+	failOnError                      bool
+	quiet                            bool
+	minServerVersion                 string
+	cacheDir                         string
+	cacheTTL                         time.Duration
+	qps                              float64
+	burst                            int
+	allProjects, enumerateNamespaces bool
+	configFile                       string
+	summaryFile                      string
+	errorLogFile                     string
+	diffDirs                         stringList
+	diffUnified                      bool
+	ff                               filterFlags
+}
+
+// addFlags defines every flag on fs, the persistent flags of the root
+// command so they can be given before or after a command name.
+func (o *options) addFlags(fs *pflag.FlagSet) {
+	fs.VarP(&o.namespaces, "namespace", "n", "Namespace(s) to process, comma-separated or repeated, which may be glob patterns (e.g. team-*). Use '*' for all (the default), '' for none, i.e. only cluster resources like --include-namespaced-resources=false.")
+	fs.StringVar(&o.namespacesFrom, "namespaces-from", "", "File listing namespaces to process in addition to --namespace, one per line with # comments, or - for stdin")
+	fs.StringVar(&o.ff.NamespaceSelector, "namespace-label-selector", "", "Process the namespaces whose labels match this selector (e.g. env=prod) instead of naming them")
+	fs.BoolVar(&o.includeCluster, "include-cluster-resources", true, "Collect cluster-scoped resources")
+	fs.BoolVar(&o.includeNamespaced, "include-namespaced-resources", true, "Collect namespaced resources, in the namespaces selected by --namespace")
+	fs.BoolVar(&o.excludeCluster, "exclude-cluster-resources", false, "Exclude cluster-scoped resources, like --include-cluster-resources=false")
+	fs.BoolVar(&o.onlyCluster, "only-cluster", false, "Only collect cluster-scoped resources, like --namespace=''")
+	fs.BoolVar(&o.onlyNamespaced, "only-namespaced", false, "Only collect namespaced resources, in all namespaces unless --namespace is given, like --exclude-cluster-resources")
+	fs.Var(&o.ff.ExcludeNamespaces, "exclude-namespace", "Skip these namespaces, which may be glob patterns (e.g. kube-system,openshift-*), comma-separated or repeated")
+	fs.BoolVar(&o.ff.Strict, "strict", false, "Fail instead of warning when a namespace given to --namespace does not exist or the server is older than --min-server-version")
+	fs.StringVar(&o.minServerVersion, "min-server-version", "", "Warn (or fail with --strict) when the Kubernetes version of a cluster is older than this (e.g. 1.27)")
+	fs.BoolVar(&o.enumerateNamespaces, "enumerate-namespaces", false, "List the namespaces first and process them one at a time instead of all at once, for users without cluster-wide list permission")
+	fs.BoolVar(&o.allProjects, "all-projects", false, "OpenShift only: process every project visible to the current user, one at a time, instead of all namespaces at once")
+	fs.StringVar(&o.ff.Before, "before", "", "Only include resources created before this RFC3339 timestamp or duration ago (e.g. 24h, 7d)")
+	fs.StringVar(&o.ff.After, "after", "", "Only include resources created at or after this RFC3339 timestamp or duration ago (e.g. 24h, 7d)")
+	fs.StringVar(&o.ff.Start, "start", "", "Only include resources created at or after this time (use with --end)")
+	fs.StringVar(&o.ff.End, "end", "", "Only include resources created at or before this time (use with --start)")
+	fs.StringVar(&o.ff.SinceEvent, "since-event", "", "Only include resources involved in an Event since this RFC3339 timestamp or duration ago (e.g. 30m)")
+	fs.StringVar(&o.ff.TimeField, "time-field", ".metadata.creationTimestamp", "Field holding the RFC3339 timestamp the time flags compare (e.g. .metadata.annotations.example\\.com/updated)")
+	fs.StringVar(&o.ff.Timezone, "timezone", "", "Time zone to show timestamps in, Local or a name like America/New_York (default UTC); the time flags then also accept local times like '2025-08-10 09:39'")
+	fs.StringVar(&o.ff.Name, "name", "", "Only include the objects with this name; with --kind or --resources they are fetched directly instead of listing every object")
+	fs.StringVar(&o.ff.NameRegex, "name-regex", "", "Only include resources whose name matches this regular expression")
+	fs.StringVar(&o.ff.OwnedBy, "owned-by", "", "Only include the object kind/name (e.g. deployment/web) and the objects it owns, directly or through their owners")
+	fs.Var(&o.ff.AnnotationSelector, "annotation-selector", "Only include resources whose annotations match: key, !key, key=value or key!=value. Comma-separated or repeated, all must match")
+	fs.StringVar(&o.ff.OutputDir, "output-dir", "", "Directory to save collected resource YAMLs")
+	fs.StringVar(&o.ff.OutputDir, "output", "", "Deprecated: use --output-dir")
+	_ = fs.MarkDeprecated("output", "use --output-dir")
+	fs.BoolVar(&o.ff.Resume, "resume", false, "Complete an interrupted --output-dir dump: skip the objects listed in its index.csv or whose file already exists")
+	fs.BoolVar(&o.ff.Compress, "compress", false, "Gzip every file of --output-dir, saving NAME.yaml.gz, while keeping the directory layout; the diff command reads them too")
+	fs.BoolVar(&o.ff.Kustomization, "kustomization", false, "Also write a kustomization.yaml listing every file of --output-dir, so the dump can be used as a kustomize base")
+	fs.BoolVar(&o.ff.Overwrite, "overwrite", false, "Write into a non-empty --output-dir, replacing the dump it holds; files of objects not collected again are kept")
+	fs.StringVar(&o.ff.Archive, "archive", "", "Write the resource YAMLs, laid out like --output-dir, into this .tar.gz file, or as an uncompressed tar to stdout with '-'")
+	fs.StringVar(&o.ff.OutputURL, "output-url", "", "Upload the resource YAMLs, laid out like --output-dir, to this object storage location (s3://bucket/prefix)")
+	fs.StringVar(&o.ff.PathTemplate, "path-template", "", "Go template for the file paths of --output-dir and --archive, with .Namespace, .Group, .Version, .Resource, .Kind and .Name (e.g. '{{.Group}}/{{.Kind}}/{{.Name}}.yaml')")
+	fs.StringVar(&o.ff.OutputFormat, "output-format", "", "Format written to stdout: "+strings.Join(outputFormats, "|")+" (default csv)")
+	fs.StringVar(&o.ff.Template, "template", "", "Go template or JSONPath executed against each object for --output-format=go-template or jsonpath (e.g. '{{.metadata.name}} {{.spec.replicas}}'), which may also follow the format as in go-template=TEMPLATE")
+	fs.StringVar(&o.ff.TemplateFile, "template-file", "", "File holding the template of --output-format=go-template or jsonpath")
+	fs.StringVar(&o.ff.SortBy, "sort-by", "", "Buffer the output and order it by "+strings.Join(sortKeys, "|"))
+	fs.BoolVar(&o.ff.AllVersions, "all-versions", false, "List every served version of each resource instead of only the preferred one, outputting an object once per version (see the apiversion column)")
+	fs.BoolVar(&o.ff.AllowDuplicates, "allow-duplicates", false, "Output an object once per API version it is listed under instead of only the first time")
+	fs.BoolVar(&o.ff.ResourceData, "resource-data", false, "Add resource details in CSV output")
+	fs.StringVar(&o.ff.Delimiter, "delimiter", ",", `CSV field delimiter, a single character; use '\t' for TSV`)
+	fs.BoolVar(&o.ff.NoHeaders, "no-headers", false, "Don't print the header line of CSV or table output")
+	fs.BoolVar(&o.ff.ShowLabels, "show-labels", false, "Add a column with the labels (k1=v1,k2=v2) to CSV, table or wide output")
+	fs.Var(&o.ff.Columns, "columns", "CSV columns to write, comma-separated: "+strings.Join(csvColumnNames(), "|")+" (default "+strings.Join(defaultCSVColumns, ",")+")")
+	fs.StringVarP(&o.ff.LabelSelector, "label-selector", "l", "", "Only include resources matching this label selector (e.g. app=nginx,tier!=db)")
+	fs.StringVar(&o.ff.FieldSelector, "field-selector", "", "Only include resources matching this field selector (e.g. status.phase=Running)")
+	fs.BoolVar(&o.ff.ReportDeprecated, "report-deprecated", false, "Only print the objects listed under, last applied with or updated through an API version that is deprecated and removed in a later Kubernetes release, e.g. before an upgrade")
+	fs.BoolVar(&o.ff.CountOnly, "count-only", false, "Only print the number of matching objects per resource type")
+	fs.BoolVar(&o.ff.Watch, "watch", false, "Keep watching the selected resources after the initial output and output every object added or modified, until interrupted or --timeout")
+	fs.BoolVar(&o.ff.Validate, "validate", false, "Check every object against the OpenAPI schema of the cluster and report the nonconforming ones (e.g. malformed custom resources) as warnings and to --error-log")
+	fs.BoolVar(&o.ff.DryRun, "dry-run", false, "Print the resource types and namespaces that would be listed, without fetching any objects")
+	fs.BoolVar(&o.ff.StripManagedFields, "strip-managed-fields", true, "Remove metadata.managedFields from output (use --strip-managed-fields=false to keep it)")
+	fs.BoolVar(&o.ff.RedactSecrets, "redact-secrets", false, "Replace Secret data/stringData values (and their last-applied-configuration annotation) with REDACTED")
+	fs.BoolVar(&o.ff.PruneStatus, "prune-status", false, "Remove the status of each object, e.g. for manifests meant to be re-applied")
+	fs.BoolVar(&o.ff.ForApply, "for-apply", false, "Remove server-populated fields so the output can be re-applied: metadata.resourceVersion, uid, generation, creationTimestamp, selfLink and managedFields, and status")
+	fs.Var(&o.ff.Fields, "fields", "Only keep these fields of each object, as paths like metadata.labels,spec.replicas (a backslash escapes a dot in a key), comma-separated or repeated. apiVersion, kind, name and namespace are always kept")
+	fs.IntVar(&o.ff.Workers, "workers", 8, "Number of resource types to list concurrently. Output order is nondeterministic when greater than 1")
+	fs.IntVar(&o.ff.NamespaceWorkers, "namespace-workers", 1, "Number of the selected namespaces to list each resource type in concurrently, on top of --workers (not with --max-objects-per-resource)")
+	fs.Var(&o.ff.Kinds, "kind", "Only list these kinds or plural resource names, comma-separated or repeated (e.g. Deployment,statefulsets)")
+	fs.Var(&o.ff.ExcludeKinds, "exclude-kind", "Skip these kinds or plural resource names, comma-separated or repeated")
+	fs.Var(&o.ff.Resources, "resources", "Only collect these resources, using the names kubectl accepts (e.g. deploy,svc,cm or deployments.apps), comma-separated or repeated")
+	fs.Var(&o.ff.Groups, "group", "Only list these API groups, comma-separated or repeated. Use 'core' for the core group. Overrides the excluded-groups file")
+	fs.Var(&o.ff.ExcludeGroups, "exclude-group", "Skip these API groups in addition to the excluded-groups file, comma-separated or repeated")
+	fs.Var(&o.ff.ExcludeResources, "exclude-resource", "Skip these resources, as group/resource or group/version/resource with 'core' for the core group (e.g. apps/v1/controllerrevisions), comma-separated or repeated")
+	fs.StringVar(&o.ff.ExcludedGroupsFile, "excluded-groups-file", os.Getenv(excludedGroupsFileEnv), "Path of the excluded-groups file (defaults to $"+excludedGroupsFileEnv+", then ~/"+defaultExcludedGroupsFile+")")
+	fs.BoolVar(&o.ff.IncludeEvents, "include-events", false, "Include events (core v1 events are skipped by default, and events.k8s.io may be excluded by the excluded-groups file)")
+	fs.BoolVar(&o.ff.OnlyCRDs, "only-crds", false, "Only collect custom resources, i.e. those defined by a CustomResourceDefinition")
+	fs.BoolVar(&o.ff.IncludeSubresources, "include-subresources", false, "Also collect subresources that support get (e.g. pods/status, deployments/scale). Issues one extra request per object")
+	fs.Int64Var(&o.ff.ChunkSize, "chunk-size", 500, "Number of objects to fetch per List request (0 fetches everything at once)")
+	fs.Int64Var(&o.ff.MaxObjectsPerResource, "max-objects-per-resource", 0, "Stop listing a resource type after this many objects, across all namespaces, as a guardrail on unfamiliar clusters (0 for no limit)")
+	fs.DurationVar(&o.ff.RequestTimeout, "request-timeout", 30*time.Second, "Timeout for each List request (0 for no timeout)")
+	fs.IntVar(&o.ff.MaxRetries, "max-retries", 3, "Retries, with exponential backoff, of a List failing with a transient error (server timeout, throttling, network)")
+	fs.DurationVar(&o.timeout, "timeout", 0, "Timeout for the whole run (0 for no timeout)")
+	fs.StringVar(&o.summaryFile, "summary-json", "", "Write a JSON summary of the run (resource types, objects per group, bytes written, duration) to this file")
+	fs.StringVar(&o.errorLogFile, "error-log", "", "Append every skipped resource type, namespace or object to this file as JSON Lines, with the error (e.g. for non-interactive runs)")
+	fs.BoolVar(&o.quiet, "quiet", false, "Only log warnings and errors, e.g. for cron jobs (see also --no-headers)")
+	fs.BoolVar(&o.failOnError, "fail-on-error", false, "Exit with status 3 if listing any resource failed (e.g. forbidden by RBAC)")
+	fs.VarPF(&logLevel, "verbose", "v", "Log verbosity, repeatable: 1 logs skipped groups/resources and errors, 2 also logs every List call").NoOptDefVal = "+1"
+	fs.StringVar(&o.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file, or '-' to read it from stdin (defaults to the content of $"+kubeconfigContentEnv+", then $KUBECONFIG, then ~/.kube/config, then in-cluster config)")
+	fs.Float64Var(&o.qps, "qps", 50, "Maximum client-side requests per second to the apiserver. Raising it speeds up large clusters but adds apiserver load")
+	fs.IntVar(&o.burst, "burst", 100, "Maximum client-side request burst above --qps")
+	fs.StringVar(&o.cacheDir, "cache-dir", "", "Cache the discovered resource types below this directory to speed up repeated runs, e.g. kubectl's ~/.kube/cache (no cache by default)")
+	fs.DurationVar(&o.cacheTTL, "cache-ttl", 10*time.Minute, "How long the --cache-dir discovery results are reused; resource types created since are missed until then")
+	fs.BoolVar(&o.insecureSkipTLSVerify, "insecure-skip-tls-verify", false, "Don't verify the apiserver's certificate. This makes the connection insecure")
+	fs.StringVar(&o.certificateAuthority, "certificate-authority", "", "Path to a CA certificate file to verify the apiserver's certificate with, instead of the kubeconfig's")
+	fs.StringVar(&o.asUser, "as", "", "Username to impersonate, e.g. system:serviceaccount:NAMESPACE:NAME to audit what a service account can see")
+	fs.Var(&o.asGroups, "as-group", "Group to impersonate, comma-separated or repeated (requires --as)")
+	fs.Var(&o.kubeContexts, "context", "Name of the kubeconfig context to use (defaults to the current context). Comma-separated or repeated to collect from several clusters into one output, tagged with the context")
+	fs.Var(&o.diffDirs, "diff", "Compare two --output-dir snapshots, given as old,new, instead of collecting resources (same as the diff command)")
+	fs.BoolVar(&o.diffUnified, "diff-unified", false, "With --diff or the diff command, also print a unified diff of every modified object")
+	fs.StringVar(&o.configFile, "config", "", "YAML file with default flag values, keyed by flag name (defaults to ~/"+defaultConfigFile+" if it exists)")
+}
+
+// commandName is the name the tool was invoked with, "kubectl get-resources"
+// when run as a kubectl plugin.
+func commandName() string {
+	cmd := filepath.Base(os.Args[0])
+	if strings.HasPrefix(cmd, "kubectl") {
+		cmd = strings.Replace(cmd, "-", " ", 1)
+		cmd = strings.Replace(cmd, "_", "-", 1)
+	}
+	return cmd
+}
+
+// newRootCommand returns the root command. Run without a command it gets
+// resources like the get command, so invocations from before the commands
+// were added keep working.
+func newRootCommand() *cobra.Command {
+	o := &options{}
+	name := commandName()
+	root := &cobra.Command{
+		Use:   filepath.Base(os.Args[0]),
+		Short: "Get resources from the K8s/OpenShift cluster",
+		Long:  "Get resources from the K8s/OpenShift cluster. Note: all flags are optional.",
+		Annotations: map[string]string{
+			cobra.CommandDisplayNameAnnotation: name,
+		},
+		Example:      examples(name),
+		Version:      versionString(),
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := applyConfigFile(cmd.Flags(), o.configFile); err != nil {
+				return fmt.Errorf("failed to load config file: %v", err)
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// --diff predates the diff command.
+			if len(o.diffDirs) > 0 {
+				if len(o.diffDirs) != 2 {
+					return fmt.Errorf("--diff takes two directories, old,new")
+				}
+				return runDiff(o.diffDirs[0], o.diffDirs[1], o.diffUnified)
+			}
+			run(o)
+			return nil
+		},
+	}
+	o.addFlags(root.PersistentFlags())
+	_ = root.RegisterFlagCompletionFunc("output-format", cobra.FixedCompletions(outputFormats, cobra.ShellCompDirectiveNoFileComp))
+	_ = root.RegisterFlagCompletionFunc("sort-by", cobra.FixedCompletions(sortKeys, cobra.ShellCompDirectiveNoFileComp))
+	_ = root.RegisterFlagCompletionFunc("columns", cobra.FixedCompletions(csvColumnNames(), cobra.ShellCompDirectiveNoFileComp))
+	registerCompletions(root, o)
+
+	// The notes apply to every command, so they follow the generated help.
+	defaultHelp := root.HelpFunc()
+	root.SetHelpFunc(func(cmd *cobra.Command, args []string) {
+		defaultHelp(cmd, args)
+		fmt.Fprint(cmd.OutOrStdout(), helpNotes)
+	})
+
+	root.AddCommand(
+		&cobra.Command{
+			Use:   "get",
+			Short: "Get the selected resources, written to stdout or as set by the output flags (the default)",
+			Args:  cobra.NoArgs,
+			Run: func(cmd *cobra.Command, args []string) {
+				run(o)
+			},
+		},
+		&cobra.Command{
+			Use:   "count",
+			Short: "Print the number of selected objects per resource type, like --count-only",
+			Args:  cobra.NoArgs,
+			Run: func(cmd *cobra.Command, args []string) {
+				o.ff.CountOnly = true
+				run(o)
+			},
+		},
+		&cobra.Command{
+			Use:   "dump [DIR]",
+			Short: "Save the selected resources as YAML files in DIR, like --output-dir (or where --archive or --output-url say)",
+			Args:  cobra.MaximumNArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				if len(args) == 1 {
+					if o.ff.OutputDir != "" && o.ff.OutputDir != args[0] {
+						return fmt.Errorf("dump takes the directory either as argument or as --output-dir")
+					}
+					o.ff.OutputDir = args[0]
+				}
+				if o.ff.OutputDir == "" && o.ff.Archive == "" && o.ff.OutputURL == "" {
+					return fmt.Errorf("dump needs a directory, --archive or --output-url")
+				}
+				run(o)
+				return nil
+			},
+		},
+		newDiffCommand(o),
+	)
+	return root
+}
+
+// newDiffCommand returns the diff command, which replaces --diff.
+func newDiffCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff OLD NEW",
+		Short: "Compare two snapshots taken with --output-dir or dump",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDiff(args[0], args[1], o.diffUnified)
+		},
+	}
+	cmd.Flags().BoolVarP(&o.diffUnified, "unified", "u", false, "Also print a unified diff of every modified object (same as --diff-unified)")
+	return cmd
+}
+
+func runDiff(oldDir, newDir string, unified bool) error {
+	if err := diffSnapshots(os.Stdout, oldDir, newDir, unified); err != nil {
+		return fmt.Errorf("failed to compare snapshots: %v", err)
+	}
+	return nil
+}
+
+// normalizeArgs rewrites long flags given with a single dash, which the flag
+// package accepted (e.g. -namespace=default), to the double dash pflag
+// expects. Shorthands such as -n and -v and everything after "--" are left
+// alone.
+func normalizeArgs(args []string, fs *pflag.FlagSet) []string {
+	normalized := make([]string, 0, len(args))
+	for i, arg := range args {
+		if arg == "--" {
+			return append(normalized, args[i:]...)
+		}
+		if strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && len(arg) > 2 {
+			name, _, _ := strings.Cut(arg[1:], "=")
+			if fs.Lookup(name) != nil {
+				arg = "-" + arg
+			}
+		}
+		normalized = append(normalized, arg)
+	}
+	return normalized
+}
+
+// examples returns the usage examples, with cmd the command name.
+func examples(cmd string) string {
+	example := func(args string) string {
+		if args == "" {
+			return cmd
+		}
+		return fmt.Sprintf("%s %s", cmd, args)
+	}
+
+	return strings.TrimSuffix(`  Get all resources (namespaced + cluster resources)
+  `+example("")+`
+
+  Get only cluster-scoped resources (like --namespace="")
+  `+example(`--only-cluster`)+`
+
+  Get only all namespaced resources (like --namespace="*" --exclude-cluster-resources=true)
+  `+example(`--only-namespaced`)+`
+
+  Get resources from every namespace starting with team-
+  `+example(`--namespace="team-*" --exclude-cluster-resources=true`)+`
+
+  Get resources from the namespaces labeled env=prod, whichever they are at the time
+  `+example(`--namespace-label-selector=env=prod --exclude-cluster-resources=true`)+`
+
+  Get resources from a non-default kubeconfig context
+  `+example(`--context=my-cluster`)+`
+
+  Take one snapshot of several clusters, with a directory per kubeconfig context
+  `+example(`--context=prod-eu,prod-us --output-dir=fleet`)+`
+
+  Check which resources a service account can read (the forbidden ones are listed at the end)
+  `+example(`--as=system:serviceaccount:ci:deployer --count-only`)+`
+
+  Use a kubeconfig held in a CI secret without writing it to disk, from stdin or $KUBECONFIG_CONTENT
+  printenv CI_KUBECONFIG | `+example(`--kubeconfig=-`)+`
+  KUBECONFIG_CONTENT="$CI_KUBECONFIG" `+example(`--namespace=default`)+`
+
+  Get specific namespace resources
+  `+example(`--namespace=default`)+`
+
+  Get multiple namespace resources
+  `+example(`--namespace=default --namespace=sample-namespace`)+`
+  `+example(`-n default,sample-namespace`)+`
+
+  Get all resources created before a given time
+  `+example(`--before=2025-08-10T09:39:09Z`)+`
+
+  Get all resources created after a given time
+  `+example(`--after=2025-08-10T09:39:09Z`)+`
+
+  Get all resources created in the last 24 hours
+  `+example(`--after=24h`)+`
+
+  Get all resources between two times
+  `+example(`--start=2025-08-10T09:39:09Z --end=2025-08-10T10:30:02Z`)+`
+
+  Get 'default' namespace resources after a given time
+  `+example(`--namespace=default --after=2025-08-10T09:39:09Z`)+`
+
+  Get only Deployments and StatefulSets
+  `+example(`--kind=Deployment,StatefulSet`)+`
+
+  Get only resources of the apps and batch API groups
+  `+example(`--group=apps,batch`)+`
+
+  Get the Deployment named web in the default namespace, without listing the others
+  `+example(`--namespace=default --kind=Deployment --name=web`)+`
+
+  Get resources whose name starts with 'ingress-'
+  `+example(`--name-regex='^ingress-'`)+`
+
+  Get resources labelled app=nginx across all resource types
+  `+example(`--label-selector=app=nginx`)+`
+
+  Get resources annotated with team=payments (matched client-side, see notes)
+  `+example(`--annotation-selector=team=payments`)+`
+
+  Get only running pods (resources not supporting the selector are skipped, see -v)
+  `+example(`--field-selector=status.phase=Running`)+`
+
+  Show which resource types would be listed in 'default', without fetching anything
+  `+example(`--namespace=default --dry-run`)+`
+
+  Count 'default' namespace resources per resource type before dumping them
+  `+example(`count --namespace=default`)+`
+
+  Get resource details added in CSV output
+  `+example(`--namespace=default --after=2025-08-10T09:39:09Z --resource-data=true`)+`
+
+  Get the kind, name and age (e.g. 5d, 3h) of 'default' namespace resources as CSV
+  `+example(`--namespace=default --columns=kind,name,age`)+`
+
+  Print a kubectl-like table of 'default' namespace resources
+  `+example(`--namespace=default --output-format=table`)+`
+
+  Print the table with kubectl-like AGE, READY and NODE columns added
+  `+example(`--namespace=default --output-format=wide`)+`
+
+  Get all resources as a single YAML List
+  `+example(`--output-format=yaml`)+`
+
+  Get 'default' namespace resources as one multi-document YAML stream for kubectl apply -f
+  `+example(`--namespace=default --output-format=yaml-stream > default.yaml`)+`
+
+  Get all resources as JSON Lines, one object per line
+  `+example(`--output-format=jsonl | jq -r .metadata.name`)+`
+
+  Take a lightweight inventory of the deployments, keeping only their labels and replica count
+  `+example(`--kind=Deployment --output-format=yaml-stream --fields=metadata.labels,spec.replicas`)+`
+
+  Print the name and replica count of every deployment with a Go template, as kubectl's go-template output
+  `+example(`--kind=Deployment --output-format=go-template --template='{{.metadata.name}} {{.spec.replicas}}'`)+`
+
+  Print the name of every pod and the node it runs on with JSONPath, applied to each object in turn
+  `+example(`--kind=Pod --output-format=jsonpath='{.metadata.name} {.spec.nodeName}'`)+`
+
+  Stream the 'default' namespace pods and every later change to them as JSON Lines
+  `+example(`--namespace=default --kind=pods --watch --output-format=jsonl`)+`
+
+  Save all output YAMLs to a directory
+  `+example(`--output-dir=<Your directory name>`)+`
+
+  Save 'default' namespace resources in directory 'default_namespace_resources'
+  `+example(`--namespace=default --output-dir=default_namespace_resources`)+`
+  `+example(`dump default_namespace_resources --namespace=default`)+`
+
+  Complete a dump that was interrupted, without rewriting the files already saved
+  `+example(`--namespace=default --output-dir=default_namespace_resources --resume`)+`
+
+  Save 'default' namespace resources as a kustomize base, e.g. to restore them with kubectl apply -k
+  `+example(`--namespace=default --output-dir=default_namespace_resources --for-apply --kustomization`)+`
+
+  Save all output YAMLs to a directory, each file gzipped
+  `+example(`--output-dir=<Your directory name> --compress`)+`
+
+  Save 'default' namespace resources into a compressed archive with the --output-dir layout
+  `+example(`--namespace=default --archive=default.tar.gz`)+`
+
+  Upload the same layout to S3, using the standard AWS credential chain (environment, ~/.aws, instance role)
+  `+example(`--namespace=default --output-url=s3://backups/cluster-a/default`)+`
+
+  Show what changed between two snapshots taken with --output-dir
+  `+example(`diff snapshot-monday snapshot-tuesday --unified`)+`
+
+  Stream the same layout as a tar to another command
+  `+example(`--namespace=default --archive=- | tar -x -C backup`)+`
+
+  Save every served version of the deployments, each in its own directory
+  `+example(`--kind=Deployment --all-versions --output-dir=backup --path-template='{{.Namespace}}/{{.Resource}}.{{.Group}}/{{.Version}}/{{.Name}}.yaml'`)+`
+
+  Save resources grouped by API group and kind instead of by namespace
+  `+example(`--output-dir=backup --path-template='{{.Group}}/{{.Kind}}/{{.Namespace}}_{{.Name}}.yaml'`)+`
+
+  List the objects still using a deprecated API version, to migrate before a cluster upgrade
+  `+example(`--report-deprecated`)+`
+
+  List the custom resources that don't conform to the schema of their CRD
+  `+example(`--only-crds --validate --count-only --error-log=invalid.jsonl`)+`
+
+  Save all output YAMLs to a directory with Secret values redacted
+  `+example(`--output-dir=<Your directory name> --redact-secrets`)+`
+
+  On OpenShift, without permission to list across namespaces, get the namespaced resources of every accessible project
+  `+example(`--all-projects --exclude-cluster-resources=true`)+`
+`, "\n")
+}
+
+// helpNotes follow the help of every command.
+const helpNotes = `
+Notes:
+  (1) Flags --output-format, --output-dir, --archive, --output-url and --count-only are mutually exclusive, and
+      --resource-data only applies to CSV output. Objects are streamed rather than gathered in a List, so the
+      go-template and jsonpath formats apply --template to each object in turn, the object being the root
+      (e.g. {.metadata.name} rather than kubectl's {.items[*].metadata.name})
+  (2) Time flags (--before, --after, --start, --end) accept an RFC3339 timestamp or a duration relative to now,
+      e.g. 90m, 24h or 7d (a leading '-' is optional): --after=7d means "created during the last seven days".
+      --after and --start include objects created exactly at the boundary, --before excludes them, and --end includes them.
+      Use --time-field to compare another RFC3339 field than metadata.creationTimestamp; objects without it are skipped.
+      --since-event takes the same values, but keeps the objects named by an Event since then (e.g. --since-event=30m
+      for "active during the last half hour"). The Events are listed in the selected namespaces first.
+      With --timezone, timestamps without an offset (2025-08-10 09:39, 2025-08-10T09:39:09 or 2025-08-10) are read
+      in that zone, and the CSV and table timestamps are shown in it.
+  (3) Annotations can't be selected server-side: with --annotation-selector (and --name-regex) every resource is still
+      listed and only the output is trimmed. Combine with --label-selector or --kind to reduce the data fetched.
+      --owned-by is applied the same way; it also holds every object in memory until the collection is done, as
+      ownership can only be resolved once the owners and their dependents were all listed.
+      --name is applied the same way, unless --kind or --resources name the resource types and --namespace the
+      namespaces: the object is then fetched directly.
+  (4) Subresources (--include-subresources) can't be listed: the parent resource is listed and the subresource is
+      fetched once per object, which is slow for large resource counts. Subresources without get (e.g. pods/exec) are skipped.
+  (5) All logs go to stderr so stdout only carries the requested output. Use -v to see why resources are
+      skipped and -v -v (or --verbose=2) to trace every List call. When the objects are written to files
+      (--output-dir, --archive to a file, --output-url) in a terminal, a progress line is shown on stderr.
+      --error-log=FILE appends every skipped resource type, namespace or object to FILE as one JSON object per
+      line (time, operation, group, version, resource, namespace, name, reason, error), e.g. for CI runs.
+      The API of an aggregated APIService that is unavailable (e.g. a metrics-server that is down) is skipped and
+      reported once, instead of failing every List of its resources.
+  (6) --output-dir, --archive and --output-url write NAMESPACE/RESOURCE.GROUP/NAME.yaml (core resources are not group-qualified),
+      with cluster-scoped objects under _cluster. Characters that are illegal in file names are replaced with '_',
+      and a -2, -3, ... suffix is added when two objects would map to the same file. See --path-template to change it;
+      there .Namespace is also _cluster for cluster-scoped objects, and empty segments (e.g. the .Group of core
+      resources) are dropped. --output-dir also writes index.csv, listing the kind, apiversion, namespace, name,
+      path and context of every file, and snapshot.json, recording the context and server version of each cluster,
+      the start and end times, the arguments and the number of objects; with --kustomization, kustomization.yaml lists
+      every file as a resource. A directory that isn't empty, so as not to mix two snapshots, is only written to
+      with --resume, which keeps the objects already saved (only the missing ones are written, though every resource
+      is still listed), or --overwrite, which rewrites every file; files of objects deleted since are left in place.
+  (7) Resource types are listed concurrently (see --workers), so the order of CSV rows may differ between runs.
+      Use --sort-by for a stable order; it holds all objects in memory until the collection is done.
+      Requests are rate limited client-side (--qps, --burst); raise the limits with care on shared clusters,
+      the apiserver answers excessive load with 429 (Too Many Requests).
+  (8) Exclude specific group(s) from retrieval by listing them in the hidden file .get-resources-excluded-groups in user's HOME directory,
+      or per run with --exclude-group. Groups passed to --group are collected even if the file excludes them.
+      Use --excluded-groups-file (or $GET_RESOURCES_EXCLUDED_GROUPS_FILE) to read another file, e.g. in CI.
+      A line can also exclude a single resource as group/resource or group/version/resource, e.g. apps/controllerrevisions
+      (use "core" for the core group, e.g. core/v1/podtemplates), like --exclude-resource.
+      Each group should be written on a separate line. Lines starting with a hash (#) are treated as comments and ignored.
+      Commonly excluded groups are:
+      $ cat ~/.get-resources-excluded-groups
+        events.k8s.io
+        metrics.k8s.io
+        image.openshift.io
+        packages.operators.coreos.com
+      To collect only a curated set of groups instead, list them the same way in ~/.get-resources-included-groups
+      (use "core" for the core group). Excluded groups are still skipped, and --group overrides the file.
+  (9) Defaults for any flag can be kept in ~/.get-resources.yaml (or the file given with --config), keyed by the long
+      flag name. Flags given on the command line override the file; lists set repeatable flags once per element:
+      $ cat ~/.get-resources.yaml
+        namespace: [default, kube-system]
+        output-format: table
+        exclude-group: [metrics.k8s.io]
+  (10) With several --context values the clusters are collected one after the other into the same output: CSV
+      gets a leading context column (unless --columns is given, which can select it), and --output-dir, --archive
+      and --output-url add a top-level directory per context. A cluster that can't be reached is skipped with a
+      warning. All contexts come from the same kubeconfig and share the connection flags (--as, --qps, ...).
+  (11) --watch outputs the current objects, then every object added or modified until interrupted (Ctrl-C) or
+      --timeout; deletions are not reported. It needs streamed output (csv, jsonl, yaml-stream, name, go-template or jsonpath).
+      Watches the apiserver closes are resumed from the last resourceVersion seen; if that version has expired,
+      the watch starts over and the current objects are output again.
+  (12) The get, count, dump and diff commands share every flag, which may come before or after the command name.
+      Without a command resources are collected like get, and long flags written with a single dash (-namespace)
+      are still accepted. Shell completion scripts are printed by the completion command, e.g. completion bash;
+      --namespace, --kind and --group (and their --exclude- forms) complete from the cluster, --context from the
+      kubeconfig. kubectl 1.26+ completes plugins through an executable named kubectl_complete-get_resources on
+      the PATH running: kubectl get-resources __complete "$@"
+  (13) The exit status is 0 on success, 1 for invalid flags and other errors, 2 when the cluster can't be reached or
+      refuses the credentials, 3 with --fail-on-error when some resources couldn't be listed, 4 when discovery
+      failed (in every context, with several), and 130 when interrupted: Ctrl-C (or SIGTERM) stops the collection
+      but still completes the output, so an --output-dir only holds whole files, all listed in index.csv. Press
+      Ctrl-C again to exit at once.
+`
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+// completionTimeout bounds the requests made while completing a flag, so a
+// slow or unreachable cluster doesn't hang the shell.
+const completionTimeout = 5 * time.Second
+
+// registerCompletions completes the flags whose values come from the cluster
+// or the kubeconfig. Errors are not shown, the shell then just offers
+// nothing.
+func registerCompletions(root *cobra.Command, o *options) {
+	for _, name := range []string{"namespace", "exclude-namespace"} {
+		_ = root.RegisterFlagCompletionFunc(name, o.completeNamespaces)
+	}
+	for _, name := range []string{"kind", "exclude-kind"} {
+		_ = root.RegisterFlagCompletionFunc(name, o.completeKinds)
+	}
+	for _, name := range []string{"group", "exclude-group"} {
+		_ = root.RegisterFlagCompletionFunc(name, o.completeGroups)
+	}
+	_ = root.RegisterFlagCompletionFunc("context", o.completeContexts)
+}
+
+// completionClients returns the clients of the first --context, honoring the
+// connection flags given so far. A kubeconfig on stdin can't be read while
+// completing.
+func (o *options) completionClients() (dynamic.Interface, discovery.DiscoveryInterface, error) {
+	if o.kubeconfig == "-" {
+		return nil, nil, errors.New("kubeconfig is read from stdin")
+	}
+	cluster, err := o.clusterOptions()
+	if err != nil {
+		return nil, nil, err
+	}
+	cluster.timeout = completionTimeout
+	kubeContext := ""
+	if len(o.kubeContexts) > 0 {
+		kubeContext = o.kubeContexts[0]
+	}
+	return cluster.clients(kubeContext)
+}
+
+func (o *options) completeNamespaces(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	dyn, _, err := o.completionClients()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+	names, err := listNames(ctx, dyn, namespacesGVR, ResourceFilter{ChunkSize: o.ff.ChunkSize, RequestTimeout: completionTimeout}, "")
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeListItem(toComplete, names)
+}
+
+// completeKinds offers the kinds and the resource names, which --kind both
+// accepts.
+func (o *options) completeKinds(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	_, disc, err := o.completionClients()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	apiResources, err := disc.ServerPreferredResources()
+	if len(apiResources) == 0 && err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var kinds []string
+	for _, list := range apiResources {
+		for _, r := range list.APIResources {
+			if strings.Contains(r.Name, "/") {
+				continue
+			}
+			kinds = append(kinds, r.Kind, r.Name)
+		}
+	}
+	return completeListItem(toComplete, kinds)
+}
+
+// completeGroups offers the API groups, the core group as "core".
+func (o *options) completeGroups(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	_, disc, err := o.completionClients()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	groupList, err := disc.ServerGroups()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var groups []string
+	for _, g := range groupList.Groups {
+		if g.Name == "" {
+			groups = append(groups, "core")
+		} else {
+			groups = append(groups, g.Name)
+		}
+	}
+	return completeListItem(toComplete, groups)
+}
+
+// completeContexts offers the contexts of the kubeconfig, which needs no
+// request to the cluster.
+func (o *options) completeContexts(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if o.kubeconfig == "-" {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	cluster, err := o.clusterOptions()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	rawConfig, err := cluster.rawConfig()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	contexts := make([]string, 0, len(rawConfig.Contexts))
+	for name := range rawConfig.Contexts {
+		contexts = append(contexts, name)
+	}
+	return completeListItem(toComplete, contexts)
+}
+
+// completeListItem completes the last item of a comma-separated flag value,
+// keeping the items before it, and leaves out the ones already given.
+func completeListItem(toComplete string, candidates []string) ([]string, cobra.ShellCompDirective) {
+	prefix, last := "", toComplete
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		prefix, last = toComplete[:i+1], toComplete[i+1:]
+	}
+	given := make(map[string]bool)
+	for _, item := range strings.Split(prefix, ",") {
+		given[item] = true
+	}
+	seen := make(map[string]bool)
+	var completions []string
+	for _, c := range candidates {
+		if given[c] || seen[c] || !strings.HasPrefix(c, last) {
+			continue
+		}
+		seen[c] = true
+		completions = append(completions, prefix+c)
+	}
+	sort.Strings(completions)
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+)
+
+// deprecatedAPI is a built-in API version that is deprecated and removed in
+// a Kubernetes release, following the deprecated API migration guide.
+type deprecatedAPI struct {
+	apiVersion  string
+	kinds       []string
+	removedIn   string
+	replacement string
+}
+
+var deprecatedAPIs = []deprecatedAPI{
+	{"extensions/v1beta1", []string{"Deployment", "DaemonSet", "ReplicaSet"}, "1.16", "apps/v1"},
+	{"extensions/v1beta1", []string{"NetworkPolicy"}, "1.16", "networking.k8s.io/v1"},
+	{"extensions/v1beta1", []string{"PodSecurityPolicy"}, "1.16", "policy/v1beta1"},
+	{"extensions/v1beta1", []string{"Ingress"}, "1.22", "networking.k8s.io/v1"},
+	{"apps/v1beta1", []string{"Deployment", "StatefulSet", "ControllerRevision"}, "1.16", "apps/v1"},
+	{"apps/v1beta2", []string{"Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "ControllerRevision"}, "1.16", "apps/v1"},
+	{"admissionregistration.k8s.io/v1beta1", []string{"MutatingWebhookConfiguration", "ValidatingWebhookConfiguration"}, "1.22", "admissionregistration.k8s.io/v1"},
+	{"apiextensions.k8s.io/v1beta1", []string{"CustomResourceDefinition"}, "1.22", "apiextensions.k8s.io/v1"},
+	{"apiregistration.k8s.io/v1beta1", []string{"APIService"}, "1.22", "apiregistration.k8s.io/v1"},
+	{"certificates.k8s.io/v1beta1", []string{"CertificateSigningRequest"}, "1.22", "certificates.k8s.io/v1"},
+	{"coordination.k8s.io/v1beta1", []string{"Lease"}, "1.22", "coordination.k8s.io/v1"},
+	{"networking.k8s.io/v1beta1", []string{"Ingress", "IngressClass"}, "1.22", "networking.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", []string{"ClusterRole", "ClusterRoleBinding", "Role", "RoleBinding"}, "1.22", "rbac.authorization.k8s.io/v1"},
+	{"scheduling.k8s.io/v1beta1", []string{"PriorityClass"}, "1.22", "scheduling.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", []string{"CSIDriver", "CSINode", "StorageClass", "VolumeAttachment"}, "1.22", "storage.k8s.io/v1"},
+	{"batch/v1beta1", []string{"CronJob"}, "1.25", "batch/v1"},
+	{"discovery.k8s.io/v1beta1", []string{"EndpointSlice"}, "1.25", "discovery.k8s.io/v1"},
+	{"events.k8s.io/v1beta1", []string{"Event"}, "1.25", "events.k8s.io/v1"},
+	{"autoscaling/v2beta1", []string{"HorizontalPodAutoscaler"}, "1.25", "autoscaling/v2"},
+	{"policy/v1beta1", []string{"PodDisruptionBudget"}, "1.25", "policy/v1"},
+	{"policy/v1beta1", []string{"PodSecurityPolicy"}, "1.25", "none, use Pod Security Admission"},
+	{"node.k8s.io/v1beta1", []string{"RuntimeClass"}, "1.25", "node.k8s.io/v1"},
+	{"autoscaling/v2beta2", []string{"HorizontalPodAutoscaler"}, "1.26", "autoscaling/v2"},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", []string{"FlowSchema", "PriorityLevelConfiguration"}, "1.26", "flowcontrol.apiserver.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", []string{"CSIStorageCapacity"}, "1.27", "storage.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", []string{"FlowSchema", "PriorityLevelConfiguration"}, "1.29", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", []string{"FlowSchema", "PriorityLevelConfiguration"}, "1.32", "flowcontrol.apiserver.k8s.io/v1"},
+}
+
+// findDeprecation returns the deprecation of kind in apiVersion, if any.
+func findDeprecation(apiVersion, kind string) (deprecatedAPI, bool) {
+	for _, d := range deprecatedAPIs {
+		if d.apiVersion == apiVersion && contains(d.kinds, kind) {
+			return d, true
+		}
+	}
+	return deprecatedAPI{}, false
+}
+
+// deprecatedUse is an object that uses a deprecated API version.
+type deprecatedUse struct {
+	context, namespace, kind, name string
+	api                            deprecatedAPI
+	// sources say where the version is used: listed, last-applied or the
+	// managers of the managed fields.
+	sources []string
+}
+
+// deprecationPrinter reports, for --report-deprecated, the objects listed
+// under a deprecated API version or last applied or updated with one. Those
+// are the manifests and clients to migrate before upgrading past the release
+// removing it.
+type deprecationPrinter struct {
+	mu          sync.Mutex
+	w           io.Writer
+	printHeader bool
+	uses        []deprecatedUse
+}
+
+func (p *deprecationPrinter) Print(rec resourceRecord) error {
+	item := rec.Item
+	kind := item.GetKind()
+	sources := make(map[string][]string)
+	var versions []string
+	use := func(apiVersion, source string) {
+		if _, ok := findDeprecation(apiVersion, kind); !ok || contains(sources[apiVersion], source) {
+			return
+		}
+		if sources[apiVersion] == nil {
+			versions = append(versions, apiVersion)
+		}
+		sources[apiVersion] = append(sources[apiVersion], source)
+	}
+
+	use(rec.GVR.GroupVersion().String(), "listed")
+	if applied := item.GetAnnotations()[lastAppliedAnnotation]; applied != "" {
+		var obj struct {
+			APIVersion string `json:"apiVersion"`
+		}
+		if err := json.Unmarshal([]byte(applied), &obj); err == nil {
+			use(obj.APIVersion, "last-applied")
+		}
+	}
+	for _, entry := range item.GetManagedFields() {
+		use(entry.APIVersion, "managed by "+entry.Manager)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, apiVersion := range versions {
+		api, _ := findDeprecation(apiVersion, kind)
+		p.uses = append(p.uses, deprecatedUse{rec.Context, item.GetNamespace(), kind, item.GetName(), api, sources[apiVersion]})
+	}
+	return nil
+}
+
+func (p *deprecationPrinter) Finish() error {
+	if len(p.uses) == 0 {
+		vlogf(logInfo, "No object uses a deprecated API version")
+		return nil
+	}
+	sort.Slice(p.uses, func(i, j int) bool {
+		a, b := p.uses[i], p.uses[j]
+		if a.api.removedIn != b.api.removedIn {
+			return utilversion.MustParseGeneric(a.api.removedIn).LessThan(utilversion.MustParseGeneric(b.api.removedIn))
+		}
+		return strings.Join([]string{a.context, a.namespace, a.kind, a.name, a.api.apiVersion}, "\x00") <
+			strings.Join([]string{b.context, b.namespace, b.kind, b.name, b.api.apiVersion}, "\x00")
+	})
+	withContext := p.uses[0].context != ""
+	tw := tabwriter.NewWriter(p.w, 10, 4, 3, ' ', 0)
+	if p.printHeader {
+		header := "NAMESPACE\tKIND\tNAME\tAPIVERSION\tREMOVED IN\tREPLACEMENT\tUSED BY"
+		if withContext {
+			header = "CONTEXT\t" + header
+		}
+		fmt.Fprintln(tw, header)
+	}
+	for _, u := range p.uses {
+		row := fmt.Sprintf("%s\t%s\t%s\t%s\t%s\t%s\t%s", u.namespace, u.kind, u.name, u.api.apiVersion, u.api.removedIn, u.api.replacement, strings.Join(u.sources, ", "))
+		if withContext {
+			row = u.context + "\t" + row
+		}
+		fmt.Fprintln(tw, row)
+	}
+	return tw.Flush()
+}
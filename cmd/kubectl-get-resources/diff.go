@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// volatileFields are the metadata fields --diff ignores since they change
+// without the object being modified.
+var volatileFields = []string{"resourceVersion", "generation", "managedFields"}
+
+// diffContext is the number of unchanged lines around each change in the
+// unified diffs.
+const diffContext = 3
+
+// maxDiffCells caps the size of the table the changed lines of a file are
+// diffed with, the product of their counts in the two versions. Beyond it the
+// file is only reported as changed instead of exhausting memory.
+const maxDiffCells = 1 << 22
+
+// diffSnapshots compares two --output-dir trees and writes which objects were
+// added, removed or modified, matching files by their relative path. With
+// unified, a diff of each modified object follows the summary.
+func diffSnapshots(w io.Writer, oldDir, newDir string, unified bool) error {
+	oldFiles, err := snapshotFiles(oldDir)
+	if err != nil {
+		return err
+	}
+	newFiles, err := snapshotFiles(newDir)
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(oldFiles)+len(newFiles))
+	for p := range oldFiles {
+		paths = append(paths, p)
+	}
+	for p := range newFiles {
+		if _, ok := oldFiles[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	var added, removed, modified, unchanged int
+	var diffs bytes.Buffer
+	for _, p := range paths {
+		oldFile, inOld := oldFiles[p]
+		newFile, inNew := newFiles[p]
+		switch {
+		case !inOld:
+			added++
+			fmt.Fprintf(w, "added:    %s\n", p)
+		case !inNew:
+			removed++
+			fmt.Fprintf(w, "removed:  %s\n", p)
+		default:
+			oldYAML, err := normalizedYAML(oldFile)
+			if err != nil {
+				return err
+			}
+			newYAML, err := normalizedYAML(newFile)
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(oldYAML, newYAML) {
+				unchanged++
+				continue
+			}
+			modified++
+			fmt.Fprintf(w, "modified: %s\n", p)
+			if unified {
+				writeUnifiedDiff(&diffs, filepath.ToSlash(oldFile), filepath.ToSlash(newFile), oldYAML, newYAML)
+			}
+		}
+	}
+	fmt.Fprintf(w, "%d added, %d removed, %d modified, %d unchanged\n", added, removed, modified, unchanged)
+	if diffs.Len() > 0 {
+		fmt.Fprintln(w)
+		_, err = diffs.WriteTo(w)
+	}
+	return err
+}
+
+// snapshotFiles returns the YAML files below dir by their slash-separated
+// relative path. Files saved with --compress are keyed without their .gz
+// suffix, so a compressed snapshot compares with an uncompressed one. The
+// kustomization.yaml written by --kustomization isn't an object and is left
+// out.
+func snapshotFiles(dir string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !(strings.HasSuffix(file, ".yaml") || strings.HasSuffix(file, ".yaml"+compressedSuffix)) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		if rel == kustomizationFileName {
+			return nil
+		}
+		files[strings.TrimSuffix(filepath.ToSlash(rel), compressedSuffix)] = file
+		return nil
+	})
+	return files, err
+}
+
+// normalizedYAML reads an object and re-encodes it without its volatile
+// fields, with sorted keys so equal objects compare equal.
+func normalizedYAML(file string) ([]byte, error) {
+	data, err := readSnapshotFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]interface{}
+	if err := yaml.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+		for _, field := range volatileFields {
+			delete(metadata, field)
+		}
+	}
+	return yaml.Marshal(obj)
+}
+
+// readSnapshotFile reads a file of an --output-dir, decompressing it if it
+// was saved with --compress.
+func readSnapshotFile(file string) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if !strings.HasSuffix(file, compressedSuffix) {
+		return io.ReadAll(f)
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	defer gz.Close()
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return data, nil
+}
+
+// writeUnifiedDiff writes a unified diff of two texts, line by line, or only
+// notes the file changed when too many lines changed to diff (maxDiffCells).
+func writeUnifiedDiff(w io.Writer, oldName, newName string, oldText, newText []byte) {
+	a := strings.SplitAfter(string(oldText), "\n")
+	b := strings.SplitAfter(string(newText), "\n")
+	if a[len(a)-1] == "" {
+		a = a[:len(a)-1]
+	}
+	if b[len(b)-1] == "" {
+		b = b[:len(b)-1]
+	}
+
+	// Lines shared at the start and end are kept as they are, which leaves
+	// only the changed middle of a[p:n] and b[p:m] to diff.
+	p := 0
+	for p < len(a) && p < len(b) && a[p] == b[p] {
+		p++
+	}
+	n, m := len(a), len(b)
+	for n > p && m > p && a[n-1] == b[m-1] {
+		n--
+		m--
+	}
+	if (n-p)*(m-p) > maxDiffCells {
+		fmt.Fprintf(w, "--- %s\n+++ %s\nfile changed: %d lines against %d are too many to diff\n", oldName, newName, n-p, m-p)
+		return
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[p+i:n]
+	// and b[p+j:m].
+	lcs := make([][]int, n-p+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m-p+1)
+	}
+	for i := n - p - 1; i >= 0; i-- {
+		for j := m - p - 1; j >= 0; j-- {
+			if a[p+i] == b[p+j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	// Walk the table into an edit script of ' ', '-' and '+' lines, keeping
+	// the position in a and b where each line sits.
+	type edit struct {
+		op   byte
+		line string
+		i, j int
+	}
+	var edits []edit
+	for k := 0; k < p; k++ {
+		edits = append(edits, edit{' ', a[k], k, k})
+	}
+	i, j := p, p
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i], i, j})
+			i++
+			j++
+		case i < n && (j == m || lcs[i-p+1][j-p] >= lcs[i-p][j-p+1]):
+			edits = append(edits, edit{'-', a[i], i, j})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j], i, j})
+			j++
+		}
+	}
+	for ; i < len(a); i, j = i+1, j+1 {
+		edits = append(edits, edit{' ', a[i], i, j})
+	}
+
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", oldName, newName)
+	for start := 0; start < len(edits); {
+		if edits[start].op == ' ' {
+			start++
+			continue
+		}
+		// Grow the hunk until diffContext*2 unchanged lines separate it from
+		// the next change.
+		from := max(start-diffContext, 0)
+		end := start
+		for k := start; k < len(edits); k++ {
+			if edits[k].op != ' ' {
+				end = k
+			} else if k-end > 2*diffContext {
+				break
+			}
+		}
+		to := min(end+diffContext+1, len(edits))
+
+		oldCount, newCount := 0, 0
+		for _, e := range edits[from:to] {
+			if e.op != '+' {
+				oldCount++
+			}
+			if e.op != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", edits[from].i+1, oldCount, edits[from].j+1, newCount)
+		for _, e := range edits[from:to] {
+			line := e.line
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n"
+			}
+			fmt.Fprintf(w, "%c%s", e.op, line)
+		}
+		start = to
+	}
+}
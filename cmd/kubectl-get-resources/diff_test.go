@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, rel := range []string{
+		indexFileName,
+		snapshotFileName,
+		kustomizationFileName,
+		"_cluster/nodes/worker-0.yaml",
+		"default/pods/web-0.yaml.gz",
+	} {
+		file := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := snapshotFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for rel := range files {
+		got = append(got, rel)
+	}
+	sort.Strings(got)
+	want := []string{"_cluster/nodes/worker-0.yaml", "default/pods/web-0.yaml"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshotFiles = %q, want %q", got, want)
+	}
+}
+
+func TestWriteUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{
+			name: "changed line",
+			old:  "a\nb\nc\nd\ne\nf\ng\nh\ni\n",
+			new:  "a\nb\nc\nd\nE\nf\ng\nh\ni\n",
+			want: "--- old\n+++ new\n@@ -2,7 +2,7 @@\n b\n c\n d\n-e\n+E\n f\n g\n h\n",
+		},
+		{
+			name: "added and removed lines",
+			old:  "a\nb\nc\n",
+			new:  "a\nc\nd\n",
+			want: "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n c\n+d\n",
+		},
+		{
+			name: "separate hunks",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			new:  "x\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ny\n",
+			want: "--- old\n+++ new\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+y\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writeUnifiedDiff(&buf, "old", "new", []byte(tt.old), []byte(tt.new))
+			if got := buf.String(); got != tt.want {
+				t.Errorf("writeUnifiedDiff =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteUnifiedDiffTooLarge(t *testing.T) {
+	var old, new strings.Builder
+	for i := 0; i < 3000; i++ {
+		fmt.Fprintf(&old, "old %d\n", i)
+		fmt.Fprintf(&new, "new %d\n", i)
+	}
+	var buf bytes.Buffer
+	writeUnifiedDiff(&buf, "old", "new", []byte("same\n"+old.String()+"same\n"), []byte("same\n"+new.String()+"same\n"))
+	want := "--- old\n+++ new\nfile changed: 3000 lines against 3000 are too many to diff\n"
+	if got := buf.String(); got != want {
+		t.Errorf("writeUnifiedDiff = %q, want %q", got, want)
+	}
+}
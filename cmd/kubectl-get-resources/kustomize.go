@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"sigs.k8s.io/yaml"
+)
+
+// kustomizationFileName is the kustomization --kustomization writes at the
+// top of an --output-dir.
+const kustomizationFileName = "kustomization.yaml"
+
+// kustomization is the part of a kustomize Kustomization that lists the
+// resource files of a dump.
+type kustomization struct {
+	APIVersion string   `json:"apiVersion"`
+	Kind       string   `json:"kind"`
+	Resources  []string `json:"resources"`
+}
+
+// writeKustomization lists every file of the index.csv in dir, which also
+// covers the objects of a resumed dump, in a kustomization.yaml next to it so
+// the directory can be used as a kustomize base.
+func writeKustomization(dir string) error {
+	rows, err := readIndex(filepath.Join(dir, indexFileName))
+	if err != nil {
+		return err
+	}
+	k := kustomization{APIVersion: "kustomize.config.k8s.io/v1beta1", Kind: "Kustomization", Resources: make([]string, 0, len(rows))}
+	for _, row := range rows {
+		k.Resources = append(k.Resources, row[4])
+	}
+	sort.Strings(k.Resources)
+	data, err := yaml.Marshal(k)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, kustomizationFileName), data, 0644)
+}
@@ -2,416 +2,3078 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"context"
-	"encoding/csv"
+	"encoding/json"
 	"errors"
-	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
+	"text/template"
 	"time"
+	"unicode/utf8"
 
+	"github.com/spf13/pflag"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/apimachinery/pkg/runtime/serializer/json"
-	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/apimachinery/pkg/types"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
 	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/disk"
+	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
 )
 
+// namespaceList accumulates repeated --namespace/-n flags. Each value may also
+// be a comma-separated list. An empty value is kept as-is since it selects only
+// cluster-scoped resources.
 type namespaceList []string
 
 func (nl *namespaceList) String() string { return strings.Join(*nl, ",") }
+func (nl *namespaceList) Type() string   { return "strings" }
 func (nl *namespaceList) Set(value string) error {
-	*nl = append(*nl, value)
+	if value == "" {
+		*nl = append(*nl, value)
+		return nil
+	}
+	for _, ns := range strings.Split(value, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			*nl = append(*nl, ns)
+		}
+	}
+	return nil
+}
+
+// stringList accumulates a repeatable flag whose values may also be
+// comma-separated.
+type stringList []string
+
+func (sl *stringList) String() string { return strings.Join(*sl, ",") }
+func (sl *stringList) Type() string   { return "strings" }
+func (sl *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*sl = append(*sl, v)
+		}
+	}
+	return nil
+}
+
+type ResourceFilter struct {
+	Before time.Time
+	After  time.Time
+	Start  time.Time
+	End    time.Time
+	// TimeField is the path of the timestamp the time filters compare,
+	// nil for metadata.creationTimestamp.
+	TimeField []string
+	// SinceEvent, if set, keeps only objects named by an Event that occurred
+	// at or after it.
+	SinceEvent time.Time
+	// EventObjects holds the objects of those Events, filled in by
+	// processResources before anything is listed.
+	EventObjects *eventObjects
+	// Validate checks every object against the cluster's OpenAPI schema,
+	// with the Validator processResources sets up.
+	Validate  bool
+	Validator *objectValidator
+	OutputDir string
+	// Resume keeps the objects a previous run saved to OutputDir and only
+	// saves the missing ones; Overwrite replaces that previous dump.
+	Resume    bool
+	Overwrite bool
+	// Kustomization also writes a kustomization.yaml listing the files of
+	// OutputDir.
+	Kustomization bool
+	// Compress gzips every file of OutputDir.
+	Compress     bool
+	ResourceData bool
+	// ShowLabels adds a labels column to CSV and table output.
+	ShowLabels bool
+	// Columns are the CSV columns, in order.
+	Columns []string
+	// Delimiter separates the CSV fields.
+	Delimiter rune
+	// NoHeaders omits the header line of CSV and table output.
+	NoHeaders     bool
+	LabelSelector string
+	FieldSelector string
+	// NamespaceSelector selects the namespaces to process by label instead
+	// of naming them.
+	NamespaceSelector string
+	// Name, if set, is the name of the objects to output. With the resource
+	// types given by Kinds or Resources they are fetched directly.
+	Name string
+	// NameRegex, if set, must match an object's name for it to be output.
+	NameRegex *regexp.Regexp
+	// AnnotationSelector lists annotation requirements that must all hold.
+	AnnotationSelector []annotationRequirement
+	// OwnedBy, if set, keeps only this object and what it transitively owns.
+	OwnedBy *ownerSelector
+	// Archive is the path of a .tar.gz to stream the YAML files into, or "-"
+	// for a plain tar on stdout.
+	Archive string
+	// OutputURL is the s3://bucket/prefix to upload the YAML files to.
+	OutputURL string
+	// PathTemplate, if set, replaces the namespace/resource/name.yaml layout
+	// of --output-dir and --archive.
+	PathTemplate *template.Template
+	// OutputFormat selects how objects are written to stdout; empty means CSV.
+	OutputFormat string
+	// Location is the --timezone timestamps are shown in, and local times of
+	// the time flags are read in; nil means UTC.
+	Location *time.Location
+	// Template is the --template of the go-template output format.
+	Template *template.Template
+	// JSONPath is the --template of the jsonpath output format.
+	JSONPath *jsonpath.JSONPath
+	// SortBy buffers the objects and orders them by this key before output.
+	SortBy string
+	// CountOnly prints per resource type totals instead of the objects.
+	CountOnly bool
+	// ReportDeprecated prints the objects using a deprecated API version
+	// instead of the objects.
+	ReportDeprecated bool
+	// DryRun prints the resource types that would be listed without listing.
+	DryRun bool
+	// Context is the kubeconfig context the objects are collected from when
+	// several are; it tags every record.
+	Context string
+	// Watch keeps watching the planned resource types after the initial
+	// objects and outputs every object added or modified.
+	Watch bool
+	// AllowDuplicates outputs an object again when it is listed under
+	// another version of its resource.
+	AllowDuplicates bool
+	// AllVersions lists every served version of a resource instead of the
+	// preferred one.
+	AllVersions bool
+	// StripManagedFields removes metadata.managedFields before output.
+	StripManagedFields bool
+	// RedactSecrets masks Secret values before output.
+	RedactSecrets bool
+	// PruneStatus removes the server-managed status before output.
+	PruneStatus bool
+	// ForApply removes the server-populated metadata in forApplyFields.
+	ForApply bool
+	// Fields, if set, are the paths of the fields to keep, on top of the
+	// identityFields.
+	Fields [][]string
+	// Workers is the number of resource types listed concurrently.
+	Workers int
+	// NamespaceWorkers is the number of namespaces a resource type is listed
+	// in concurrently, when namespaces are selected.
+	NamespaceWorkers int
+	// Kinds and ExcludeKinds hold lowercased kinds or plural resource names
+	// to restrict to or skip.
+	Kinds        map[string]bool
+	ExcludeKinds map[string]bool
+	// ExcludeNamespaces holds path.Match patterns of namespaces to skip.
+	ExcludeNamespaces []string
+	// ResourceNames are the --resources arguments, kubectl-style names such
+	// as deploy or deployments.apps. processResources resolves them into
+	// Resources before planning.
+	ResourceNames []string
+	Resources     map[schema.GroupResource]bool
+	// Groups and ExcludeGroups hold API groups ("" for core) to restrict to or
+	// skip, on top of the excluded-groups file.
+	Groups        map[string]bool
+	ExcludeGroups map[string]bool
+	// ExcludeResources holds group/resource and group/version/resource keys
+	// (see resourceExclusion) to skip.
+	ExcludeResources map[string]bool
+	// ExcludedGroupsFile overrides the path of the excluded-groups file.
+	ExcludedGroupsFile string
+	// IncludeEvents lists core v1 events, which are skipped by default.
+	IncludeEvents bool
+	// IncludeSubresources collects readable subresources such as pods/status.
+	IncludeSubresources bool
+	// OnlyCRDs restricts the collection to custom resources.
+	OnlyCRDs bool
+	// Strict fails the run when a requested namespace doesn't exist, or the
+	// server is older than --min-server-version, instead of warning.
+	Strict bool
+	// ChunkSize is the page size of List calls; 0 disables pagination.
+	ChunkSize int64
+	// MaxObjectsPerResource stops listing a resource type after that many
+	// objects; 0 means no limit.
+	MaxObjectsPerResource int64
+	// RequestTimeout bounds each List request; 0 means no limit.
+	RequestTimeout time.Duration
+	// MaxRetries is how often a List failing with a transient error is retried.
+	MaxRetries int
+}
+
+const (
+	redactedValue         = "REDACTED"
+	lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+)
+
+// verbosity is a counting flag: every -v (or --verbose) raises the log level
+// by one, and --verbose=N sets it directly.
+type verbosity int
+
+func (v *verbosity) String() string { return strconv.Itoa(int(*v)) }
+func (v *verbosity) Type() string   { return "count" }
+func (v *verbosity) Set(value string) error {
+	switch value {
+	case "+1", "true":
+		*v++
+		return nil
+	case "false":
+		*v = 0
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid verbosity %q", value)
+	}
+	*v = verbosity(n)
+	return nil
+}
+
+// Log levels of vlogf.
+const (
+	// logInfo reports how the run goes, silenced by --quiet.
+	logInfo = 0
+	// logSkipped reports skipped groups and resources, swallowed errors and
+	// the server version.
+	logSkipped = 1
+	// logProgress reports every List issued.
+	logProgress = 2
+)
+
+// logLevel is the verbosity selected with -v/--verbose, -1 with --quiet.
+var logLevel verbosity
+
+// vlogf logs to stderr if the verbosity is at least level.
+func vlogf(level int, format string, args ...interface{}) {
+	if int(logLevel) >= level {
+		log.Printf(format, args...)
+	}
+}
+
+// filterFlags holds the raw flag values that validateAndBuildFilter turns into
+// a ResourceFilter.
+type filterFlags struct {
+	Before                string
+	After                 string
+	Start                 string
+	End                   string
+	TimeField             string
+	SinceEvent            string
+	Validate              bool
+	OutputDir             string
+	Resume                bool
+	Overwrite             bool
+	Kustomization         bool
+	Compress              bool
+	Archive               string
+	OutputURL             string
+	PathTemplate          string
+	ResourceData          bool
+	ShowLabels            bool
+	Columns               stringList
+	Delimiter             string
+	NoHeaders             bool
+	LabelSelector         string
+	NamespaceSelector     string
+	FieldSelector         string
+	Name                  string
+	NameRegex             string
+	AnnotationSelector    stringList
+	OwnedBy               string
+	OutputFormat          string
+	Timezone              string
+	Template              string
+	TemplateFile          string
+	SortBy                string
+	CountOnly             bool
+	ReportDeprecated      bool
+	DryRun                bool
+	Watch                 bool
+	AllowDuplicates       bool
+	AllVersions           bool
+	StripManagedFields    bool
+	RedactSecrets         bool
+	PruneStatus           bool
+	ForApply              bool
+	Fields                stringList
+	Workers               int
+	NamespaceWorkers      int
+	Kinds                 stringList
+	ExcludeKinds          stringList
+	ExcludeNamespaces     stringList
+	Resources             stringList
+	Groups                stringList
+	ExcludeGroups         stringList
+	ExcludeResources      stringList
+	IncludeEvents         bool
+	IncludeSubresources   bool
+	OnlyCRDs              bool
+	Strict                bool
+	ExcludedGroupsFile    string
+	ChunkSize             int64
+	MaxObjectsPerResource int64
+	RequestTimeout        time.Duration
+	MaxRetries            int
+}
+
+// Exit codes, so scripts can tell the failures apart.
+const (
+	exitOK          = 0
+	exitUsage       = 1   // invalid flags, or any other failure
+	exitConnection  = 2   // the cluster couldn't be reached or refused the credentials
+	exitPartial     = 3   // with --fail-on-error, some resources couldn't be listed
+	exitDiscovery   = 4   // no resources could be discovered
+	exitInterrupted = 130 // interrupted by Ctrl-C or SIGTERM, like the shell reports a command killed by SIGINT
+)
+
+// fatalf logs like log.Fatalf but exits with code.
+func fatalf(code int, format string, v ...interface{}) {
+	log.Printf(format, v...)
+	exit(code)
+}
+
+// exit exits with code once the --error-log is closed, which the deferred
+// Close of run doesn't do as os.Exit skips it. Every exit of a run, once the
+// log is open, goes through here.
+func exit(code int) {
+	if errorLog != nil {
+		errorLog.Close()
+	}
+	os.Exit(code)
+}
+
+// isConnectionError reports whether err means the apiserver couldn't be
+// reached, its certificate wasn't trusted or it refused the credentials.
+// Forbidden isn't one: the credentials were accepted but lack the rights to
+// the request, which --fail-on-error reports as a partial collection.
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || apierrors.IsUnauthorized(err)
+}
+
+// exitCodeFor is exitConnection for a connection error, code otherwise.
+func exitCodeFor(err error, code int) int {
+	if isConnectionError(err) {
+		return exitConnection
+	}
+	return code
+}
+
+func main() {
+	// Only the requested output (CSV header and rows, or another format) is
+	// written to stdout so it can be piped or redirected; every diagnostic
+	// goes to stderr through log.
+	log.SetOutput(os.Stderr)
+
+	cmd := newRootCommand()
+	cmd.SetArgs(normalizeArgs(os.Args[1:], cmd.PersistentFlags()))
+	if err := cmd.Execute(); err != nil {
+		os.Exit(exitUsage)
+	}
+}
+
+// run collects the resources selected by o, for the get, count and dump
+// commands.
+func run(o *options) {
+	filter, err := validateAndBuildFilter(o.ff)
+	if err != nil {
+		log.Fatalf("Flag validation error: %v", err)
+	}
+	if o.timeout < 0 {
+		log.Fatalf("Flag validation error: --timeout must not be negative")
+	}
+	if o.quiet {
+		if logLevel > 0 {
+			log.Fatalf("Flag validation error: cannot use both --quiet and --verbose")
+		}
+		logLevel = -1
+	}
+	var minServerVersion *utilversion.Version
+	if o.minServerVersion != "" {
+		minServerVersion, err = utilversion.ParseGeneric(o.minServerVersion)
+		if err != nil {
+			log.Fatalf("Flag validation error: invalid --min-server-version: %v", err)
+		}
+	}
+	if o.cacheTTL <= 0 {
+		log.Fatalf("Flag validation error: --cache-ttl must be positive")
+	}
+	if o.qps <= 0 || o.burst <= 0 {
+		log.Fatalf("Flag validation error: --qps and --burst must be positive")
+	}
+	if o.namespacesFrom != "" {
+		if o.namespacesFrom == "-" && o.kubeconfig == "-" {
+			log.Fatalf("Flag validation error: --namespaces-from and --kubeconfig can't both read stdin")
+		}
+		namespaces, err := readNamespacesFrom(o.namespacesFrom)
+		if err != nil {
+			log.Fatalf("Flag validation error: invalid --namespaces-from: %v", err)
+		}
+		o.namespaces = append(o.namespaces, namespaces...)
+	}
+	if o.onlyCluster {
+		if o.onlyNamespaced {
+			log.Fatalf("Flag validation error: --only-cluster and --only-namespaced are mutually exclusive")
+		}
+		if len(o.namespaces) > 0 || o.ff.NamespaceSelector != "" || o.allProjects || o.enumerateNamespaces {
+			log.Fatalf("Flag validation error: --only-cluster can't be used with the flags selecting namespaces")
+		}
+		o.includeNamespaced = false
+	}
+	if o.onlyNamespaced {
+		o.includeCluster = false
+	}
+	if o.allProjects && len(o.namespaces) > 0 {
+		log.Fatalf("Flag validation error: --all-projects and --namespace are mutually exclusive")
+	}
+	if o.ff.NamespaceSelector != "" && (len(o.namespaces) > 0 || o.allProjects || o.enumerateNamespaces) {
+		log.Fatalf("Flag validation error: --namespace-label-selector can't be used with --namespace, --namespaces-from, --all-projects or --enumerate-namespaces")
+	}
+	for _, ns := range o.namespaces {
+		if _, err := path.Match(ns, ""); err != nil {
+			log.Fatalf("Flag validation error: invalid --namespace pattern %q: %v", ns, err)
+		}
+	}
+	if len(o.asGroups) > 0 && o.asUser == "" {
+		log.Fatalf("Flag validation error: --as-group requires --as")
+	}
+	if o.insecureSkipTLSVerify && o.certificateAuthority != "" {
+		log.Fatalf("Flag validation error: cannot use both --insecure-skip-tls-verify and --certificate-authority")
+	}
+	if o.certificateAuthority != "" {
+		if _, err := os.Stat(o.certificateAuthority); err != nil {
+			log.Fatalf("Flag validation error: invalid --certificate-authority: %v", err)
+		}
+	}
+	if len(o.kubeContexts) > 1 {
+		if filter.Watch {
+			log.Fatalf("Flag validation error: --watch can only be used with a single --context")
+		}
+		if filter.Kustomization {
+			log.Fatalf("Flag validation error: --kustomization can only be used with a single --context, kustomize rejects an object given twice")
+		}
+		// Rows of different clusters are told apart by a leading context column.
+		if len(o.ff.Columns) == 0 {
+			filter.Columns = append([]string{"context"}, filter.Columns...)
+		}
+	}
+	if o.enumerateNamespaces && (o.allProjects || (len(o.namespaces) > 0 && !contains(o.namespaces, "*"))) {
+		log.Fatalf("Flag validation error: --enumerate-namespaces only applies to all namespaces and can't be used with --all-projects")
+	}
+
+	if o.errorLogFile != "" {
+		errorLog, err = openErrorLog(o.errorLogFile)
+		if err != nil {
+			log.Fatalf("Failed to open --error-log: %v", err)
+		}
+		defer errorLog.Close()
+	}
+
+	// Ctrl-C stops the collection, or the watch, but still flushes the
+	// output and prints the summary, so that an --output-dir only holds
+	// complete files, all listed in its manifest. A second Ctrl-C exits at
+	// once.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	var interrupted atomic.Bool
+	go func() {
+		<-signals
+		// Restore the default handling, so the next signal kills the process.
+		signal.Stop(signals)
+		interrupted.Store(true)
+		cancel()
+		if !filter.Watch {
+			log.Println("Interrupted, finishing the output; press Ctrl-C again to exit at once")
+		}
+	}()
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+
+	// The kubeconfig is read once, stdin can't be read again for the next
+	// context.
+	cluster, err := o.clusterOptions()
+	if err != nil {
+		fatalf(exitUsage, "Failed to read kubeconfig: %v", err)
+	}
+	if o.insecureSkipTLSVerify {
+		log.Println("Warning: --insecure-skip-tls-verify is set, the apiserver's certificate will not be checked")
+	}
+	if o.asUser != "" {
+		vlogf(logInfo, "Impersonating %s", o.asUser)
+	}
+
+	printer, err := newPrinter(ctx, filter, countingWriter{os.Stdout})
+	if err != nil {
+		fatalf(exitUsage, "Failed to set up output: %v", err)
+	}
+
+	// Objects go to files on interactive runs with --output-dir and the like,
+	// leaving the terminal free for a progress indicator.
+	if writesFiles := filter.OutputDir != "" || filter.OutputURL != "" || (filter.Archive != "" && filter.Archive != "-"); writesFiles && !filter.DryRun && !filter.Watch && logLevel >= logInfo && isTerminal(os.Stdout) && isTerminal(os.Stderr) {
+		progress = startProgress(os.Stderr)
+		log.SetOutput(progress)
+	}
+
+	// Without --context the kubeconfig's current context is used. With several,
+	// every record is tagged with the context it was collected from.
+	contexts := []string(o.kubeContexts)
+	if len(contexts) == 0 {
+		contexts = []string{""}
+	}
+	for _, kubeContext := range contexts {
+		if ctx.Err() != nil {
+			break
+		}
+		dynClient, discClient, err := cluster.clients(kubeContext)
+		if err != nil {
+			fatalf(exitUsage, "Failed to load cluster config: %v", err)
+		}
+		serverVersion := ""
+		if info, err := discClient.ServerVersion(); err == nil {
+			serverVersion = info.GitVersion
+			vlogf(logSkipped, "Server version of %s: %s", describeContext(kubeContext), serverVersion)
+			checkServerVersion(kubeContext, serverVersion, minServerVersion, filter.Strict)
+		} else {
+			vlogf(logSkipped, "Failed to get the server version of %s: %v", describeContext(kubeContext), err)
+		}
+		if filter.OutputDir != "" && !filter.DryRun {
+			name := kubeContext
+			if name == "" {
+				name = cluster.currentContext()
+			}
+			summary.addCluster(name, serverVersion)
+		}
+		clusterFilter := filter
+		if len(contexts) > 1 {
+			vlogf(logInfo, "Collecting from context %s", kubeContext)
+			clusterFilter.Context = kubeContext
+		}
+		collect(ctx, dynClient, discClient, clusterFilter, printer, o.namespaces, o.includeCluster && !o.excludeCluster, o.includeNamespaced, o.allProjects, o.enumerateNamespaces)
+	}
+
+	if progress != nil {
+		progress.finish()
+		log.SetOutput(os.Stderr)
+	}
+
+	if err := printer.Finish(); err != nil {
+		fatalf(exitUsage, "Failed to write output: %v", err)
+	}
+	listFailures.printSummary()
+	if filter.OutputDir != "" && !filter.DryRun {
+		if err := summary.writeSnapshot(filter.OutputDir, os.Args[1:]); err != nil {
+			fatalf(exitUsage, "Failed to write %s: %v", snapshotFileName, err)
+		}
+	}
+	if o.summaryFile != "" {
+		if err := summary.write(o.summaryFile); err != nil {
+			fatalf(exitUsage, "Failed to write --summary-json: %v", err)
+		}
+	}
+	if interrupted.Load() && !filter.Watch {
+		log.Println("Interrupted before all resources were collected, the output is incomplete.")
+		exit(exitInterrupted)
+	}
+	vlogf(logInfo, "Done collecting resources.")
+	if len(contexts) > 1 && listFailures.contextFailures() == len(contexts) {
+		exit(exitDiscovery)
+	}
+	if o.failOnError && listFailures.count() > 0 {
+		exit(exitPartial)
+	}
+}
+
+// clusterOptions are the flags that select a cluster and how to connect to
+// it, for all of its contexts.
+type clusterOptions struct {
+	kubeconfig            string
+	content               []byte
+	source                string
+	inMemory              bool
+	insecureSkipTLSVerify bool
+	certificateAuthority  string
+	asUser                string
+	asGroups              []string
+	qps                   float64
+	burst                 int
+	// timeout bounds each request, none if zero.
+	timeout time.Duration
+	// cacheDir, if set, caches the discovery results for cacheTTL.
+	cacheDir string
+	cacheTTL time.Duration
+}
+
+// clusterOptions reads the kubeconfig content, if given in memory, and
+// gathers the connection flags.
+func (o *options) clusterOptions() (clusterOptions, error) {
+	content, source, inMemory, err := kubeconfigContent(o.kubeconfig)
+	if err != nil {
+		return clusterOptions{}, err
+	}
+	return clusterOptions{
+		kubeconfig:            o.kubeconfig,
+		content:               content,
+		source:                source,
+		inMemory:              inMemory,
+		insecureSkipTLSVerify: o.insecureSkipTLSVerify,
+		certificateAuthority:  o.certificateAuthority,
+		asUser:                o.asUser,
+		asGroups:              o.asGroups,
+		qps:                   o.qps,
+		burst:                 o.burst,
+		cacheDir:              o.cacheDir,
+		cacheTTL:              o.cacheTTL,
+	}, nil
+}
+
+// clients returns the clients of kubeContext, or of the current context if
+// it is empty.
+func (o clusterOptions) clients(kubeContext string) (dynamic.Interface, discovery.DiscoveryInterface, error) {
+	var config *rest.Config
+	var err error
+	if o.inMemory {
+		config, err = buildConfigFromBytes(o.content, o.source, kubeContext)
+	} else {
+		config, err = buildConfig(o.kubeconfig, kubeContext)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	// Like kubectl, the flags replace the CA of the kubeconfig, which client-go
+	// refuses to combine with Insecure.
+	if o.insecureSkipTLSVerify {
+		config.TLSClientConfig.Insecure = true
+		config.TLSClientConfig.CAFile = ""
+		config.TLSClientConfig.CAData = nil
+	}
+	if o.certificateAuthority != "" {
+		config.TLSClientConfig.CAFile = o.certificateAuthority
+		config.TLSClientConfig.CAData = nil
+		config.TLSClientConfig.Insecure = false
+	}
+	if o.asUser != "" {
+		config.Impersonate = rest.ImpersonationConfig{UserName: o.asUser, Groups: o.asGroups}
+	}
+	// client-go defaults to 5 QPS / 10 burst, which throttles a run that lists
+	// hundreds of resource types. The apiserver still protects itself with API
+	// Priority and Fairness, so excessive values mostly yield 429 responses.
+	config.QPS = float32(o.qps)
+	config.Burst = o.burst
+	config.Timeout = o.timeout
+	dynClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	if o.cacheDir != "" {
+		// Laid out like kubectl's cache, which it can then share.
+		discoveryDir := filepath.Join(o.cacheDir, "discovery", discoveryCacheName(config.Host))
+		discClient, err := disk.NewCachedDiscoveryClientForConfig(config, discoveryDir, filepath.Join(o.cacheDir, "http"), o.cacheTTL)
+		if err != nil {
+			return nil, nil, err
+		}
+		return dynClient, discClient, nil
+	}
+	discClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dynClient, discClient, nil
+}
+
+// discoveryCacheName is the directory of the discovery cache of the apiserver
+// at host, named as kubectl does: api.example.com_6443 for
+// https://api.example.com:6443.
+func discoveryCacheName(host string) string {
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+	return unsafeCacheChars.ReplaceAllString(host, "_")
+}
+
+var unsafeCacheChars = regexp.MustCompile(`[^(\w/.)]`)
+
+// rawConfig loads the kubeconfig, without resolving a context.
+func (o clusterOptions) rawConfig() (*clientcmdapi.Config, error) {
+	if o.inMemory {
+		return clientcmd.Load(o.content)
+	}
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = o.kubeconfig
+	return loadingRules.Load()
+}
+
+// describeContext names kubeContext in log messages.
+func describeContext(kubeContext string) string {
+	if kubeContext == "" {
+		return "the current context"
+	}
+	return "context " + kubeContext
+}
+
+// checkServerVersion warns when the server of kubeContext is older than
+// minVersion, or fails the run with strict.
+func checkServerVersion(kubeContext, serverVersion string, minVersion *utilversion.Version, strict bool) {
+	if minVersion == nil {
+		return
+	}
+	v, err := utilversion.ParseGeneric(serverVersion)
+	if err != nil {
+		log.Printf("Warning: can't compare server version %q of %s with --min-server-version: %v", serverVersion, describeContext(kubeContext), err)
+		return
+	}
+	if v.AtLeast(minVersion) {
+		return
+	}
+	if strict {
+		fatalf(exitUsage, "Server version %s of %s is older than --min-server-version %s", serverVersion, describeContext(kubeContext), minVersion)
+	}
+	log.Printf("Warning: server version %s of %s is older than --min-server-version %s, some resources may be missing or behave differently", serverVersion, describeContext(kubeContext), minVersion)
+}
+
+// currentContext returns the name of the current context of the kubeconfig,
+// empty if it can't be read.
+func (o clusterOptions) currentContext() string {
+	rawConfig, err := o.rawConfig()
+	if err != nil {
+		return ""
+	}
+	return rawConfig.CurrentContext
+}
+
+// collect resolves the namespaces to process in one cluster, expanding
+// --all-projects, --enumerate-namespaces and patterns and dropping the
+// excluded namespaces, then collects its resources into printer.
+func collect(ctx context.Context, dynClient dynamic.Interface, discClient discovery.DiscoveryInterface, filter ResourceFilter, printer resourcePrinter, namespaces namespaceList, includeCluster, includeNamespaced, allProjects, enumerateNamespaces bool) {
+	var err error
+	if allProjects {
+		namespaces, err = listProjects(ctx, dynClient, discClient, filter)
+		if err != nil {
+			fatalf(exitCodeFor(err, exitUsage), "Failed to list projects: %v", err)
+		}
+		if len(namespaces) == 0 {
+			fatalf(exitUsage, "No projects are visible to the current user")
+		}
+		vlogf(logInfo, "Processing %d projects", len(namespaces))
+	}
+	if enumerateNamespaces {
+		namespaces, err = listNames(ctx, dynClient, namespacesGVR, filter, "")
+		if err != nil {
+			fatalf(exitCodeFor(err, exitUsage), "Failed to list namespaces: %v", err)
+		}
+		if len(namespaces) == 0 {
+			fatalf(exitUsage, "No namespaces are visible to the current user")
+		}
+		vlogf(logInfo, "Processing %d namespaces", len(namespaces))
+	}
+	if filter.NamespaceSelector != "" {
+		namespaces, err = listNames(ctx, dynClient, namespacesGVR, filter, filter.NamespaceSelector)
+		if err != nil {
+			fatalf(exitCodeFor(err, exitUsage), "Failed to list namespaces for --namespace-label-selector: %v", err)
+		}
+		if len(namespaces) == 0 {
+			if !includeCluster {
+				vlogf(logInfo, "Nothing to process: no namespace matches --namespace-label-selector and cluster excluded")
+				return
+			}
+			log.Printf("Warning: no namespace matches --namespace-label-selector %q", filter.NamespaceSelector)
+			namespaces = namespaceList{""}
+		} else {
+			vlogf(logInfo, "Processing %d namespaces matching %s", len(namespaces), filter.NamespaceSelector)
+		}
+	}
+
+	if !allProjects && !enumerateNamespaces && filter.NamespaceSelector == "" {
+		namespaces = dropMissingNamespaces(ctx, dynClient, namespaces, filter)
+		if len(namespaces) == 0 {
+			if !includeCluster {
+				vlogf(logInfo, "Nothing to process: none of the requested namespaces exists and cluster excluded")
+				return
+			}
+			namespaces = namespaceList{""}
+		}
+	}
+
+	if hasNamespacePatterns(namespaces) {
+		all, err := listNames(ctx, dynClient, namespacesGVR, filter, "")
+		if err != nil {
+			fatalf(exitCodeFor(err, exitUsage), "Failed to list namespaces to match --namespace patterns: %v", err)
+		}
+		namespaces = expandNamespacePatterns(namespaces, all)
+		if len(namespaces) == 0 {
+			if !includeCluster {
+				vlogf(logInfo, "Nothing to process: no namespace matches --namespace and cluster excluded")
+				return
+			}
+			namespaces = namespaceList{""}
+		}
+	}
+
+	// Excluded namespaces are dropped before listing where the namespaces are
+	// known; lists across all namespaces are filtered in filterAndOutput.
+	if len(filter.ExcludeNamespaces) > 0 && len(namespaces) > 0 && !contains(namespaces, "*") && !(len(namespaces) == 1 && namespaces[0] == "") {
+		var kept namespaceList
+		for _, ns := range namespaces {
+			if namespaceExcluded(filter.ExcludeNamespaces, ns) {
+				vlogf(logSkipped, "Skipping excluded namespace %s", ns)
+				continue
+			}
+			kept = append(kept, ns)
+		}
+		if len(kept) == 0 {
+			if !includeCluster {
+				vlogf(logInfo, "Nothing to process: every selected namespace is excluded and cluster excluded")
+				return
+			}
+			kept = namespaceList{""}
+		}
+		namespaces = kept
+	}
+
+	scope, includeNamespaced, ok := listScope(namespaces, includeCluster, includeNamespaced)
+	if !ok {
+		vlogf(logInfo, "Nothing to process: both cluster and namespaced resources excluded")
+		return
+	}
+	processResources(ctx, dynClient, discClient, filter, printer, scope, includeCluster, includeNamespaced)
+}
+
+// listScope decides what collect lists. It comes down to two independent
+// toggles: cluster-scoped resources, and namespaced resources in the selected
+// namespaces, all of them (a nil scope) when none or '*' is given. An empty
+// --namespace turns the latter off. ok is false when neither is left.
+func listScope(namespaces namespaceList, includeCluster, includeNamespaced bool) (scope []string, namespaced, ok bool) {
+	switch {
+	case len(namespaces) == 1 && namespaces[0] == "":
+		includeNamespaced = false
+	case len(namespaces) > 0 && !contains(namespaces, "*"):
+		scope = namespaces
+	}
+	return scope, includeNamespaced, includeCluster || includeNamespaced
+}
+
+// Validation and Filtering
+func validateAndBuildFilter(ff filterFlags) (ResourceFilter, error) {
+	var filter ResourceFilter
+	var err error
+
+	if ff.Before != "" && ff.After != "" {
+		return filter, errors.New("cannot use both --before and --after")
+	}
+	if (ff.Start != "" && ff.End == "") || (ff.Start == "" && ff.End != "") {
+		return filter, errors.New("--start and --end must be used together")
+	}
+	if (ff.Before != "" || ff.After != "") && (ff.Start != "" || ff.End != "") {
+		return filter, errors.New("--before/--after cannot be used with --start/--end")
+	}
+
+	if ff.Timezone != "" {
+		filter.Location, err = time.LoadLocation(ff.Timezone)
+		if err != nil {
+			return filter, fmt.Errorf("invalid --timezone: %v", err)
+		}
+	}
+
+	now := time.Now()
+	if ff.Before != "" {
+		filter.Before, err = parseTimeFlag(ff.Before, now, filter.Location)
+		if err != nil {
+			return filter, fmt.Errorf("invalid --before timestamp: %v", err)
+		}
+	}
+	if ff.After != "" {
+		filter.After, err = parseTimeFlag(ff.After, now, filter.Location)
+		if err != nil {
+			return filter, fmt.Errorf("invalid --after timestamp: %v", err)
+		}
+	}
+	if ff.Start != "" {
+		filter.Start, err = parseTimeFlag(ff.Start, now, filter.Location)
+		if err != nil {
+			return filter, fmt.Errorf("invalid --start timestamp: %v", err)
+		}
+		filter.End, err = parseTimeFlag(ff.End, now, filter.Location)
+		if err != nil {
+			return filter, fmt.Errorf("invalid --end timestamp: %v", err)
+		}
+	}
+
+	if ff.SinceEvent != "" {
+		filter.SinceEvent, err = parseTimeFlag(ff.SinceEvent, now, filter.Location)
+		if err != nil {
+			return filter, fmt.Errorf("invalid --since-event: %v", err)
+		}
+	}
+	if ff.TimeField != "" && ff.TimeField != ".metadata.creationTimestamp" {
+		filter.TimeField, err = parseFieldPath(ff.TimeField)
+		if err != nil {
+			return filter, fmt.Errorf("invalid --time-field: %v", err)
+		}
+	}
+
+	// Like kubectl, the template may follow the format: jsonpath={.metadata.name}.
+	if format, text, ok := strings.Cut(ff.OutputFormat, "="); ok && (format == formatGoTemplate || format == formatJSONPath) {
+		if ff.Template != "" || ff.TemplateFile != "" {
+			return filter, fmt.Errorf("--output-format=%s= and --template or --template-file are mutually exclusive", format)
+		}
+		ff.OutputFormat, ff.Template = format, text
+	}
+	if ff.OutputFormat != "" && !contains(outputFormats, ff.OutputFormat) {
+		return filter, fmt.Errorf("invalid --output-format %q: must be one of %s", ff.OutputFormat, strings.Join(outputFormats, ", "))
+	}
+	var outputs []string
+	for flagName, set := range map[string]bool{
+		"--output-dir":        ff.OutputDir != "",
+		"--archive":           ff.Archive != "",
+		"--output-url":        ff.OutputURL != "",
+		"--output-format":     ff.OutputFormat != "",
+		"--count-only":        ff.CountOnly,
+		"--report-deprecated": ff.ReportDeprecated,
+	} {
+		if set {
+			outputs = append(outputs, flagName)
+		}
+	}
+	if len(outputs) > 1 {
+		sort.Strings(outputs)
+		return filter, fmt.Errorf("%s are mutually exclusive", strings.Join(outputs, " and "))
+	}
+	if ff.ResourceData && len(outputs) > 0 && ff.OutputFormat != formatCSV {
+		return filter, errors.New("--resource-data can only be used with CSV output")
+	}
+	if len(ff.Columns) > 0 && len(outputs) > 0 && ff.OutputFormat != formatCSV {
+		return filter, errors.New("--columns can only be used with CSV output")
+	}
+	filter.Columns = append([]string(nil), defaultCSVColumns...)
+	if len(ff.Columns) > 0 {
+		filter.Columns = filter.Columns[:0]
+		for _, column := range ff.Columns {
+			column = strings.ToLower(column)
+			if _, ok := csvColumns[column]; !ok {
+				return filter, fmt.Errorf("invalid --columns %q: must be one of %s", column, strings.Join(csvColumnNames(), ", "))
+			}
+			filter.Columns = append(filter.Columns, column)
+		}
+	}
+	filter.Delimiter, err = parseDelimiter(ff.Delimiter)
+	if err != nil {
+		return filter, fmt.Errorf("invalid --delimiter: %v", err)
+	}
+	if filter.Delimiter != ',' && len(outputs) > 0 && ff.OutputFormat != formatCSV {
+		return filter, errors.New("--delimiter can only be used with CSV output")
+	}
+	if ff.ShowLabels {
+		if len(outputs) > 0 && ff.OutputFormat != formatCSV && ff.OutputFormat != formatTable && ff.OutputFormat != formatWide {
+			return filter, errors.New("--show-labels can only be used with CSV, table or wide output")
+		}
+		if !contains(filter.Columns, "labels") {
+			filter.Columns = append(filter.Columns, "labels")
+		}
+	}
+	if ff.ResourceData && !contains(filter.Columns, "data") {
+		filter.Columns = append(filter.Columns, "data")
+	}
+
+	if ff.Template != "" && ff.TemplateFile != "" {
+		return filter, errors.New("cannot use both --template and --template-file")
+	}
+	if templated := ff.OutputFormat == formatGoTemplate || ff.OutputFormat == formatJSONPath; (ff.Template != "" || ff.TemplateFile != "") != templated {
+		return filter, errors.New("--output-format=go-template and jsonpath require --template or --template-file, which only apply to them")
+	}
+	if ff.TemplateFile != "" {
+		text, err := os.ReadFile(ff.TemplateFile)
+		if err != nil {
+			return filter, fmt.Errorf("invalid --template-file: %v", err)
+		}
+		ff.Template = string(text)
+	}
+	switch {
+	case ff.OutputFormat == formatGoTemplate:
+		filter.Template, err = parseOutputTemplate(ff.Template)
+		if err != nil {
+			return filter, fmt.Errorf("invalid --template: %v", err)
+		}
+	case ff.OutputFormat == formatJSONPath:
+		filter.JSONPath, err = parseJSONPath(ff.Template)
+		if err != nil {
+			return filter, fmt.Errorf("invalid JSONPath template: %v", err)
+		}
+	}
+
+	if ff.SortBy != "" {
+		if !contains(sortKeys, ff.SortBy) {
+			return filter, fmt.Errorf("invalid --sort-by %q: must be one of %s", ff.SortBy, strings.Join(sortKeys, ", "))
+		}
+		if ff.OutputDir != "" || ff.Archive != "" || ff.OutputURL != "" || ff.CountOnly || ff.ReportDeprecated {
+			return filter, errors.New("--sort-by only applies to output written to stdout")
+		}
+	}
+
+	for _, field := range ff.Fields {
+		if !strings.HasPrefix(field, ".") {
+			field = "." + field
+		}
+		fieldPath, err := parseFieldPath(field)
+		if err != nil {
+			return filter, fmt.Errorf("invalid --fields: %v", err)
+		}
+		filter.Fields = append(filter.Fields, fieldPath)
+	}
+	if len(ff.Fields) > 0 {
+		switch {
+		case len(outputs) == 0 || ff.CountOnly || ff.ReportDeprecated || ff.OutputFormat == formatCSV || ff.OutputFormat == formatTable || ff.OutputFormat == formatWide || ff.OutputFormat == formatName:
+			return filter, errors.New("--fields only applies to whole objects: --output-dir, --archive, --output-url or an --output-format like yaml or json")
+		case ff.OwnedBy != "":
+			return filter, errors.New("--fields can't be used with --owned-by, which needs the owner references")
+		case ff.SortBy == sortByCreationTimestamp:
+			return filter, errors.New("--fields can't be used with --sort-by=creationtimestamp")
+		}
+	}
+
+	if ff.Watch {
+		if ff.OutputDir != "" || ff.Archive != "" || ff.OutputURL != "" || ff.CountOnly || ff.ReportDeprecated || ff.SortBy != "" || ff.OwnedBy != "" {
+			return filter, errors.New("--watch can't be used with --output-dir, --archive, --output-url, --count-only, --report-deprecated, --sort-by or --owned-by, which need the whole collection")
+		}
+		if !contains(watchFormats, ff.OutputFormat) {
+			return filter, fmt.Errorf("--watch needs streamed output: --output-format must be one of %s", strings.Join(watchFormats[1:], ", "))
+		}
+		if ff.IncludeSubresources {
+			return filter, errors.New("--watch can't be used with --include-subresources, subresources can't be watched")
+		}
+	}
+
+	if (ff.Resume || ff.Overwrite) && ff.OutputDir == "" {
+		return filter, errors.New("--resume and --overwrite require --output-dir")
+	}
+	if ff.ReportDeprecated && ff.AllVersions {
+		return filter, errors.New("--report-deprecated can't be used with --all-versions, every object would be reported for each deprecated version still served")
+	}
+	if ff.Kustomization {
+		if ff.OutputDir == "" {
+			return filter, errors.New("--kustomization requires --output-dir")
+		}
+		if ff.IncludeSubresources {
+			return filter, errors.New("--kustomization can't be used with --include-subresources, subresources are no resources kustomize can apply")
+		}
+		if ff.Compress {
+			return filter, errors.New("--kustomization can't be used with --compress, kustomize doesn't read compressed files")
+		}
+	}
+	if ff.Compress && ff.OutputDir == "" {
+		return filter, errors.New("--compress requires --output-dir (--archive is compressed as a whole)")
+	}
+	if ff.Resume && ff.Overwrite {
+		return filter, errors.New("cannot use both --resume and --overwrite")
+	}
+
+	if ff.OutputURL != "" {
+		if _, _, err := parseS3URL(ff.OutputURL); err != nil {
+			return filter, fmt.Errorf("invalid --output-url: %v", err)
+		}
+	}
+	if ff.PathTemplate != "" {
+		if ff.OutputDir == "" && ff.Archive == "" && ff.OutputURL == "" {
+			return filter, errors.New("--path-template requires --output-dir, --archive or --output-url")
+		}
+		filter.PathTemplate, err = parsePathTemplate(ff.PathTemplate)
+		if err != nil {
+			return filter, fmt.Errorf("invalid --path-template: %v", err)
+		}
+	}
+
+	if ff.ExcludedGroupsFile != "" {
+		// Unlike the default location, a file that was asked for must exist.
+		if _, err := os.Stat(ff.ExcludedGroupsFile); err != nil {
+			return filter, fmt.Errorf("invalid --excluded-groups-file: %v", err)
+		}
+	}
+
+	if ff.Workers < 1 {
+		return filter, errors.New("--workers must be at least 1")
+	}
+	if ff.NamespaceWorkers < 1 {
+		return filter, errors.New("--namespace-workers must be at least 1")
+	}
+	if ff.ChunkSize < 0 {
+		return filter, errors.New("--chunk-size must not be negative")
+	}
+	if ff.MaxObjectsPerResource < 0 {
+		return filter, errors.New("--max-objects-per-resource must not be negative")
+	}
+	if ff.RequestTimeout < 0 {
+		return filter, errors.New("--request-timeout must not be negative")
+	}
+	if ff.MaxRetries < 0 {
+		return filter, errors.New("--max-retries must not be negative")
+	}
+
+	for _, g := range ff.Groups {
+		if contains(ff.ExcludeGroups, g) {
+			return filter, fmt.Errorf("group %q is given to both --group and --exclude-group", g)
+		}
+	}
+
+	for _, entry := range ff.ExcludeResources {
+		key, err := resourceExclusion(entry)
+		if err != nil || !strings.Contains(key, "/") {
+			return filter, fmt.Errorf("invalid --exclude-resource %q: must be group/resource or group/version/resource", entry)
+		}
+		if filter.ExcludeResources == nil {
+			filter.ExcludeResources = make(map[string]bool)
+		}
+		filter.ExcludeResources[key] = true
+	}
+
+	for _, pattern := range ff.ExcludeNamespaces {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return filter, fmt.Errorf("invalid --exclude-namespace %q: %v", pattern, err)
+		}
+	}
+
+	if ff.LabelSelector != "" {
+		if _, err := labels.Parse(ff.LabelSelector); err != nil {
+			return filter, fmt.Errorf("invalid --label-selector: %v", err)
+		}
+	}
+
+	if ff.NamespaceSelector != "" {
+		if _, err := labels.Parse(ff.NamespaceSelector); err != nil {
+			return filter, fmt.Errorf("invalid --namespace-label-selector: %v", err)
+		}
+	}
+
+	if ff.FieldSelector != "" {
+		if _, err := fields.ParseSelector(ff.FieldSelector); err != nil {
+			return filter, fmt.Errorf("invalid --field-selector: %v", err)
+		}
+	}
+
+	if ff.Name != "" {
+		if strings.Contains(ff.Name, "/") {
+			return filter, fmt.Errorf("invalid --name %q: must not contain '/'", ff.Name)
+		}
+		if ff.OwnedBy != "" {
+			return filter, errors.New("--name can't be used with --owned-by")
+		}
+		filter.Name = ff.Name
+	}
+
+	if ff.NameRegex != "" {
+		filter.NameRegex, err = regexp.Compile(ff.NameRegex)
+		if err != nil {
+			return filter, fmt.Errorf("invalid --name-regex: %v", err)
+		}
+	}
+
+	for _, term := range ff.AnnotationSelector {
+		req, err := parseAnnotationRequirement(term)
+		if err != nil {
+			return filter, fmt.Errorf("invalid --annotation-selector: %v", err)
+		}
+		filter.AnnotationSelector = append(filter.AnnotationSelector, req)
+	}
+
+	if ff.OwnedBy != "" {
+		if ff.ForApply {
+			return filter, errors.New("--owned-by can't be used with --for-apply, which removes the UIDs owner references point to")
+		}
+		kind, name, ok := strings.Cut(ff.OwnedBy, "/")
+		if !ok || kind == "" || name == "" || strings.Contains(name, "/") {
+			return filter, fmt.Errorf("invalid --owned-by %q: must be kind/name", ff.OwnedBy)
+		}
+		filter.OwnedBy = &ownerSelector{kind: kind, name: name}
+	}
+
+	filter.OutputDir = ff.OutputDir
+	filter.Resume = ff.Resume
+	filter.Overwrite = ff.Overwrite
+	filter.Kustomization = ff.Kustomization
+	filter.Validate = ff.Validate
+	filter.Compress = ff.Compress
+	filter.Archive = ff.Archive
+	filter.OutputURL = ff.OutputURL
+	filter.OutputFormat = ff.OutputFormat
+	filter.SortBy = ff.SortBy
+	filter.CountOnly = ff.CountOnly
+	filter.ReportDeprecated = ff.ReportDeprecated
+	filter.DryRun = ff.DryRun
+	filter.Watch = ff.Watch
+	// Every change of a watched object is output, and every version of one
+	// listed with --all-versions, so none is deduplicated.
+	filter.AllowDuplicates = ff.AllowDuplicates || ff.Watch || ff.AllVersions
+	filter.AllVersions = ff.AllVersions
+	filter.ResourceData = ff.ResourceData
+	filter.ShowLabels = ff.ShowLabels
+	filter.NoHeaders = ff.NoHeaders
+	filter.LabelSelector = ff.LabelSelector
+	filter.NamespaceSelector = ff.NamespaceSelector
+	filter.FieldSelector = ff.FieldSelector
+	// The report needs the API versions of the managed fields.
+	filter.StripManagedFields = (ff.StripManagedFields || ff.ForApply) && !ff.ReportDeprecated
+	filter.RedactSecrets = ff.RedactSecrets
+	filter.PruneStatus = ff.PruneStatus || ff.ForApply
+	filter.ForApply = ff.ForApply
+	filter.Workers = ff.Workers
+	filter.NamespaceWorkers = ff.NamespaceWorkers
+	filter.Kinds = lowerSet(ff.Kinds)
+	filter.ExcludeKinds = lowerSet(ff.ExcludeKinds)
+	filter.ExcludeNamespaces = ff.ExcludeNamespaces
+	filter.ResourceNames = ff.Resources
+	filter.Groups = groupSet(ff.Groups)
+	filter.ExcludeGroups = groupSet(ff.ExcludeGroups)
+	filter.IncludeEvents = ff.IncludeEvents
+	filter.IncludeSubresources = ff.IncludeSubresources
+	filter.OnlyCRDs = ff.OnlyCRDs
+	filter.Strict = ff.Strict
+	filter.ExcludedGroupsFile = ff.ExcludedGroupsFile
+	filter.ChunkSize = ff.ChunkSize
+	filter.MaxObjectsPerResource = ff.MaxObjectsPerResource
+	filter.RequestTimeout = ff.RequestTimeout
+	filter.MaxRetries = ff.MaxRetries
+	return filter, nil
+}
+
+// parseDelimiter returns the single rune of a --delimiter, accepting \t for
+// a tab since it is awkward to pass literally.
+func parseDelimiter(value string) (rune, error) {
+	if value == `\t` {
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(value)
+	if size == 0 || size != len(value) || r == utf8.RuneError {
+		return 0, fmt.Errorf("%q must be a single character", value)
+	}
+	if r == '"' || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("%q can't be used as a delimiter", value)
+	}
+	return r, nil
+}
+
+// kubeconfigContentEnv holds a whole kubeconfig, e.g. from a CI secret, so
+// it doesn't have to be written to a file.
+const kubeconfigContentEnv = "KUBECONFIG_CONTENT"
+
+// kubeconfigContent returns the kubeconfig given in memory rather than as a
+// file: read from stdin with --kubeconfig=-, or else the content of
+// $KUBECONFIG_CONTENT when no --kubeconfig is given. ok is false when the
+// kubeconfig should be loaded from disk instead.
+func kubeconfigContent(kubeconfig string) (content []byte, source string, ok bool, err error) {
+	if kubeconfig == "-" {
+		content, err = io.ReadAll(os.Stdin)
+		return content, "stdin", true, err
+	}
+	if value := os.Getenv(kubeconfigContentEnv); kubeconfig == "" && value != "" {
+		return []byte(value), "$" + kubeconfigContentEnv, true, nil
+	}
+	return nil, "", false, nil
+}
+
+// buildConfigFromBytes builds the client config from kubeconfig content,
+// using kubeContext instead of its current context when set.
+func buildConfigFromBytes(content []byte, source, kubeContext string) (*rest.Config, error) {
+	rawConfig, err := clientcmd.Load(content)
+	if err != nil {
+		return nil, fmt.Errorf("parsing kubeconfig from %s: %v", source, err)
+	}
+	if err := checkContext(*rawConfig, kubeContext); err != nil {
+		return nil, err
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+	config, err := clientcmd.NewNonInteractiveClientConfig(*rawConfig, kubeContext, overrides, nil).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("using kubeconfig from %s: %v", source, err)
+	}
+	return config, nil
+}
+
+// checkContext returns an error listing the available contexts if
+// kubeContext is set but not defined in rawConfig.
+func checkContext(rawConfig clientcmdapi.Config, kubeContext string) error {
+	if kubeContext == "" {
+		return nil
+	}
+	if _, ok := rawConfig.Contexts[kubeContext]; !ok {
+		names := make([]string, 0, len(rawConfig.Contexts))
+		for name := range rawConfig.Contexts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("context %q not found in kubeconfig (available contexts: %s)", kubeContext, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// buildConfig loads the client config from the explicit --kubeconfig path if
+// given, otherwise from the standard loading rules (which honor KUBECONFIG and
+// merge multiple files). When no kubeconfig can be found at all, it falls back
+// to the in-cluster config so the plugin can run inside a pod. A non-empty
+// kubeContext overrides the current context of the merged config.
+func buildConfig(kubeconfig, kubeContext string) (*rest.Config, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfig != "" {
+		loadingRules.ExplicitPath = kubeconfig
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+
+	if kubeContext != "" {
+		rawConfig, err := clientConfig.RawConfig()
+		if err != nil {
+			return nil, fmt.Errorf("reading kubeconfig: %v", err)
+		}
+		if err := checkContext(rawConfig, kubeContext); err != nil {
+			return nil, err
+		}
+	}
+
+	config, err := clientConfig.ClientConfig()
+	if err == nil {
+		return config, nil
+	}
+	if kubeconfig != "" {
+		return nil, fmt.Errorf("using kubeconfig from --kubeconfig=%s: %v", kubeconfig, err)
+	}
+	if !clientcmd.IsEmptyConfig(err) {
+		return nil, fmt.Errorf("using kubeconfig from default loading rules (%s): %v", strings.Join(loadingRules.GetLoadingPrecedence(), string(filepath.ListSeparator)), err)
+	}
+
+	config, inClusterErr := rest.InClusterConfig()
+	if inClusterErr != nil {
+		return nil, fmt.Errorf("no kubeconfig found via default loading rules (%s) and in-cluster config failed: %v", strings.Join(loadingRules.GetLoadingPrecedence(), string(filepath.ListSeparator)), inClusterErr)
+	}
+	return config, nil
+}
+
+// parseTimeFlag parses a time filter value. It is either an RFC3339 timestamp
+// or a duration (Go syntax plus a "d" unit for days, e.g. 30m, 24h, 7d, 1d12h)
+// meaning that long before now. A leading "-" is accepted and means the same,
+// so --after=-7d and --after=7d both select the last seven days. With a
+// --timezone, loc is set and timestamps without an offset such as
+// 2025-08-10 09:39 are accepted too, as a time in loc.
+func parseTimeFlag(value string, now time.Time, loc *time.Location) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+	if loc != nil {
+		for _, layout := range localTimeLayouts {
+			if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+				return t, nil
+			}
+		}
+	}
+	d, durErr := parseDuration(strings.TrimPrefix(value, "-"))
+	if durErr != nil {
+		if loc != nil {
+			return time.Time{}, fmt.Errorf("%q is neither an RFC3339 timestamp, a local time like 2006-01-02 15:04 nor a duration like 24h or 7d", value)
+		}
+		return time.Time{}, fmt.Errorf("%q is neither an RFC3339 timestamp nor a duration like 24h or 7d", value)
+	}
+	return now.Add(-d), nil
+}
+
+// localTimeLayouts are the timestamps without an offset parseTimeFlag
+// accepts with a --timezone.
+var localTimeLayouts = []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"}
+
+// parseDuration extends time.ParseDuration with a leading days component.
+func parseDuration(value string) (time.Duration, error) {
+	var days time.Duration
+	if i := strings.Index(value, "d"); i > 0 {
+		n, err := strconv.Atoi(value[:i])
+		if err != nil {
+			return 0, err
+		}
+		days = time.Duration(n) * 24 * time.Hour
+		value = value[i+1:]
+		if value == "" {
+			return days, nil
+		}
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	return days + d, nil
+}
+
+// lowerSet returns the lowercased values as a set, or nil if there are none.
+func lowerSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[strings.ToLower(v)] = true
+	}
+	return set
+}
+
+// annotationRequirement is one term of --annotation-selector.
+type annotationRequirement struct {
+	key   string
+	value string
+	op    string // "exists", "!exists", "=" or "!="
+}
+
+func parseAnnotationRequirement(term string) (annotationRequirement, error) {
+	var req annotationRequirement
+	switch {
+	case strings.Contains(term, "!="):
+		parts := strings.SplitN(term, "!=", 2)
+		req = annotationRequirement{key: parts[0], value: parts[1], op: "!="}
+	case strings.Contains(term, "="):
+		parts := strings.SplitN(term, "=", 2)
+		req = annotationRequirement{key: parts[0], value: parts[1], op: "="}
+	case strings.HasPrefix(term, "!"):
+		req = annotationRequirement{key: term[1:], op: "!exists"}
+	default:
+		req = annotationRequirement{key: term, op: "exists"}
+	}
+	req.key = strings.TrimSpace(req.key)
+	if req.key == "" {
+		return req, fmt.Errorf("missing annotation key in %q", term)
+	}
+	return req, nil
+}
+
+// matchesAnnotations reports whether annotations satisfy every requirement.
+// A key!=value requirement also holds when the key is absent.
+func matchesAnnotations(reqs []annotationRequirement, annotations map[string]string) bool {
+	for _, req := range reqs {
+		value, ok := annotations[req.key]
+		switch req.op {
+		case "exists":
+			if !ok {
+				return false
+			}
+		case "!exists":
+			if ok {
+				return false
+			}
+		case "=":
+			if !ok || value != req.value {
+				return false
+			}
+		case "!=":
+			if ok && value == req.value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// groupSet returns the API groups as a set, mapping "core" to the core
+// group's empty name, or nil if there are none.
+func groupSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		if v == "core" {
+			v = ""
+		}
+		set[v] = true
+	}
+	return set
+}
+
+// matchesKind reports whether the resource's kind, plural or singular name is
+// in the lowercased set.
+func matchesKind(set map[string]bool, resource metav1.APIResource) bool {
+	return set[strings.ToLower(resource.Kind)] || set[strings.ToLower(resource.Name)] || (resource.SingularName != "" && set[strings.ToLower(resource.SingularName)])
+}
+
+func contains(list []string, val string) bool {
+	for _, v := range list {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
+
+// Different Processing functions
+// namespacesGVR is listed by --enumerate-namespaces.
+var namespacesGVR = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+
+// eventsGVR is listed by --since-event.
+var eventsGVR = schema.GroupVersionResource{Version: "v1", Resource: "events"}
+
+// eventObjects is the set of objects Events refer to. Objects are matched by
+// UID, or by kind, namespace and name for references without one.
+type eventObjects struct {
+	uids  map[types.UID]bool
+	names map[string]bool
+}
+
+func (e *eventObjects) has(item *unstructured.Unstructured) bool {
+	return e.uids[item.GetUID()] || e.names[item.GetKind()+"/"+item.GetNamespace()+"/"+item.GetName()]
+}
+
+// listEventObjects collects the objects involved in the Events of the given
+// namespaces (nil for all) that last occurred at or after filter.SinceEvent.
+func listEventObjects(ctx context.Context, dyn dynamic.Interface, namespaces []string, filter ResourceFilter) *eventObjects {
+	objects := &eventObjects{uids: make(map[types.UID]bool), names: make(map[string]bool)}
+	opts := ResourceFilter{ChunkSize: filter.ChunkSize, RequestTimeout: filter.RequestTimeout, MaxRetries: filter.MaxRetries}
+	add := func(items []unstructured.Unstructured) {
+		for i := range items {
+			if eventTime(&items[i]).Before(filter.SinceEvent) {
+				continue
+			}
+			ref, _, _ := unstructured.NestedStringMap(items[i].Object, "involvedObject")
+			if ref["uid"] != "" {
+				objects.uids[types.UID(ref["uid"])] = true
+			} else {
+				objects.names[ref["kind"]+"/"+ref["namespace"]+"/"+ref["name"]] = true
+			}
+		}
+	}
+
+	if namespaces == nil || contains(namespaces, "*") {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	for _, ns := range namespaces {
+		if err := listPages(ctx, dyn.Resource(eventsGVR).Namespace(ns), opts, add); err != nil {
+			fatalf(exitUsage, "Failed to list events for --since-event: %v", err)
+		}
+	}
+	vlogf(logProgress, "%d objects had events since %s", len(objects.uids)+len(objects.names), filter.SinceEvent.Format(time.RFC3339))
+	return objects
+}
+
+// eventTime returns when an Event last occurred, from the newest of the
+// timestamps the different event sources fill in.
+func eventTime(event *unstructured.Unstructured) time.Time {
+	latest := event.GetCreationTimestamp().Time
+	for _, field := range [][]string{{"lastTimestamp"}, {"eventTime"}, {"series", "lastObservedTime"}} {
+		value, _, _ := unstructured.NestedString(event.Object, field...)
+		if t, err := time.Parse(time.RFC3339Nano, value); err == nil && t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
+
+// resolveResources maps kubectl-style resource names (short names, singular
+// or plural names, optionally qualified with a group) to the resources they
+// stand for, using the server's discovery information. A name matching
+// resources in several groups is an error listing the candidates.
+func resolveResources(disc discovery.DiscoveryInterface, names []string) (map[schema.GroupResource]bool, error) {
+	cached := memory.NewMemCacheClient(disc)
+	mapper := restmapper.NewShortcutExpander(restmapper.NewDeferredDiscoveryRESTMapper(cached), cached, func(msg string) { log.Printf("Warning: %s", msg) })
+
+	resources := make(map[schema.GroupResource]bool)
+	for _, name := range names {
+		gvrs, err := mapper.ResourcesFor(schema.ParseGroupResource(strings.ToLower(name)).WithVersion(""))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		candidates := make(map[schema.GroupResource]bool)
+		for _, gvr := range gvrs {
+			candidates[gvr.GroupResource()] = true
+		}
+		if len(candidates) == 0 {
+			return nil, fmt.Errorf("%s: no such resource", name)
+		}
+		if len(candidates) > 1 {
+			qualified := make([]string, 0, len(candidates))
+			for gr := range candidates {
+				qualified = append(qualified, gr.String())
+			}
+			sort.Strings(qualified)
+			return nil, fmt.Errorf("%s is ambiguous, use one of %s", name, strings.Join(qualified, ", "))
+		}
+		for gr := range candidates {
+			resources[gr] = true
+		}
+	}
+	return resources, nil
+}
+
+// crdsGVR lists the CustomResourceDefinitions for --only-crds.
+var crdsGVR = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+
+// onlyCustomResources keeps the jobs of resources defined by a
+// CustomResourceDefinition. If the CRDs can't be listed, it falls back to
+// keeping the groups that don't look built-in.
+func onlyCustomResources(ctx context.Context, dyn dynamic.Interface, jobs []listJob, filter ResourceFilter) []listJob {
+	custom := make(map[schema.GroupResource]bool)
+	opts := ResourceFilter{ChunkSize: filter.ChunkSize, RequestTimeout: filter.RequestTimeout, MaxRetries: filter.MaxRetries}
+	err := listPages(ctx, dyn.Resource(crdsGVR), opts, func(items []unstructured.Unstructured) {
+		for _, item := range items {
+			group, _, _ := unstructured.NestedString(item.Object, "spec", "group")
+			plural, _, _ := unstructured.NestedString(item.Object, "spec", "names", "plural")
+			custom[schema.GroupResource{Group: group, Resource: plural}] = true
+		}
+	})
+	if err != nil {
+		log.Printf("Warning: can't list CustomResourceDefinitions, guessing custom resources by group: %v", err)
+	}
+
+	var kept []listJob
+	for _, job := range jobs {
+		resource, _, _ := strings.Cut(job.gvr.Resource, "/")
+		isCustom := custom[schema.GroupResource{Group: job.gvr.Group, Resource: resource}]
+		if err != nil {
+			isCustom = !isBuiltinGroup(job.gvr.Group)
+		}
+		if !isCustom {
+			vlogf(logSkipped, "Skipping %s, not a custom resource", describeGVR(job.gvr))
+			continue
+		}
+		kept = append(kept, job)
+	}
+	return kept
+}
+
+// apiServicesGVR lists the APIServices whose availability is checked before
+// listing.
+var apiServicesGVR = schema.GroupVersionResource{Group: "apiregistration.k8s.io", Version: "v1", Resource: "apiservices"}
+
+// skipUnavailableAPIs drops the jobs of group versions served by an
+// aggregated APIService that isn't Available. Discovery may still list their
+// resources, e.g. from the --cache-dir, but every List would fail; instead
+// each unavailable API is reported once. If the APIServices can't be listed
+// the jobs are kept.
+func skipUnavailableAPIs(ctx context.Context, dyn dynamic.Interface, jobs []listJob, filter ResourceFilter) []listJob {
+	list, err := listPage(ctx, dyn.Resource(apiServicesGVR), metav1.ListOptions{}, filter.RequestTimeout)
+	if err != nil {
+		vlogf(logSkipped, "Not checking the availability of APIServices, listing them failed: %v", err)
+		return jobs
+	}
+	unavailable := make(map[schema.GroupVersion]error)
+	for _, item := range list.Items {
+		// Local APIServices, without a service, are served by the apiserver itself.
+		if _, found, _ := unstructured.NestedMap(item.Object, "spec", "service"); !found {
+			continue
+		}
+		group, _, _ := unstructured.NestedString(item.Object, "spec", "group")
+		version, _, _ := unstructured.NestedString(item.Object, "spec", "version")
+		if err := apiServiceAvailability(item); err != nil {
+			unavailable[schema.GroupVersion{Group: group, Version: version}] = err
+		}
+	}
+
+	var kept []listJob
+	reported := make(map[schema.GroupVersion]bool)
+	for _, job := range jobs {
+		gv := job.gvr.GroupVersion()
+		err, ok := unavailable[gv]
+		if !ok {
+			kept = append(kept, job)
+			continue
+		}
+		if !reported[gv] {
+			reported[gv] = true
+			reportUnavailableAPI(gv, filter.Context, err)
+		}
+	}
+	return kept
+}
+
+// apiServiceAvailability returns why an APIService isn't Available, or nil
+// if it is.
+func apiServiceAvailability(item unstructured.Unstructured) error {
+	conditions, _, _ := unstructured.NestedSlice(item.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != "Available" {
+			continue
+		}
+		if condition["status"] == "True" {
+			return nil
+		}
+		return fmt.Errorf("APIService %s is unavailable (%v): %v", item.GetName(), condition["reason"], condition["message"])
+	}
+	return fmt.Errorf("APIService %s is not reported available", item.GetName())
+}
+
+// reportUnavailableAPI records a group version that can't be collected
+// because the apiserver serving it failed discovery or is unavailable.
+func reportUnavailableAPI(gv schema.GroupVersion, kubeContext string, err error) {
+	log.Printf("Warning: skipping %s, its API is unavailable: %v", gv, err)
+	errorLog.record(errorLogEntry{Operation: "discovery", Context: kubeContext, Group: gv.Group, Version: gv.Version}, err)
+	scope := ""
+	if kubeContext != "" {
+		scope = " in context " + kubeContext
+	}
+	listFailures.add(listFailure{api: gv, scope: scope, err: err})
+}
+
+// isBuiltinGroup reports whether group looks like a Kubernetes API group:
+// the core group, unqualified groups such as apps or batch, or groups under
+// k8s.io and kubernetes.io.
+func isBuiltinGroup(group string) bool {
+	return !strings.Contains(group, ".") ||
+		group == "k8s.io" || strings.HasSuffix(group, ".k8s.io") ||
+		group == "kubernetes.io" || strings.HasSuffix(group, ".kubernetes.io")
+}
+
+// projectsGVR is the OpenShift resource listing the projects, i.e. the
+// namespaces, a user has access to.
+var projectsGVR = schema.GroupVersionResource{Group: "project.openshift.io", Version: "v1", Resource: "projects"}
+
+// listProjects returns the names of the OpenShift projects visible to the
+// current user. Unlike namespaces, projects can be listed without cluster-wide
+// permissions, so they can stand in for metav1.NamespaceAll on clusters that
+// forbid listing across namespaces.
+func listProjects(ctx context.Context, dyn dynamic.Interface, disc discovery.DiscoveryInterface, filter ResourceFilter) ([]string, error) {
+	groups, err := disc.ServerGroups()
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups.Groups {
+		if group.Name == projectsGVR.Group {
+			return listNames(ctx, dyn, projectsGVR, filter, "")
+		}
+	}
+	return nil, fmt.Errorf("%s is not served, --all-projects requires an OpenShift cluster", projectsGVR.Group)
+}
+
+// listNames returns the sorted names of the objects of a cluster-scoped
+// resource, all of them or those matching labelSelector. The object filters
+// don't apply, only the listing options do.
+func listNames(ctx context.Context, dyn dynamic.Interface, gvr schema.GroupVersionResource, filter ResourceFilter, labelSelector string) ([]string, error) {
+	opts := ResourceFilter{ChunkSize: filter.ChunkSize, RequestTimeout: filter.RequestTimeout, MaxRetries: filter.MaxRetries, LabelSelector: labelSelector}
+	var names []string
+	err := listPages(ctx, dyn.Resource(gvr), opts, func(items []unstructured.Unstructured) {
+		for _, item := range items {
+			names = append(names, item.GetName())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// defaultConfigFile is read from the home directory when --config isn't given.
+const defaultConfigFile = ".get-resources.yaml"
+
+// applyConfigFile sets every flag listed in the YAML config file that wasn't
+// given on the command line, so CLI flags override the file. Keys are long
+// flag names; list values set a repeatable flag once per element:
+//
+//	namespace: [default, kube-system]
+//	output-format: table
+//	exclude-group: [metrics.k8s.io]
+//	after: 24h
+//
+// A missing file is only an error if it was named with --config.
+func applyConfigFile(fs *pflag.FlagSet, name string) error {
+	explicit := name != ""
+	if !explicit {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		name = filepath.Join(home, defaultConfigFile)
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+
+	// Short and deprecated aliases share the Value of their long flag, so
+	// setting either one on the command line overrides the file.
+	setOnCLI := make(map[pflag.Value]bool)
+	fs.Visit(func(f *pflag.Flag) { setOnCLI[f.Value] = true })
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		f := fs.Lookup(key)
+		if f == nil || key == "config" {
+			return fmt.Errorf("%s: unknown flag %q", name, key)
+		}
+		if setOnCLI[f.Value] {
+			continue
+		}
+		list, ok := values[key].([]interface{})
+		if !ok {
+			list = []interface{}{values[key]}
+		}
+		for _, value := range list {
+			if err := f.Value.Set(configValue(value)); err != nil {
+				return fmt.Errorf("%s: invalid value for %q: %v", name, key, err)
+			}
+		}
+	}
 	return nil
 }
 
-type ResourceFilter struct {
-	Before       time.Time
-	After        time.Time
-	Start        time.Time
-	End          time.Time
-	OutputDir    string
-	ResourceData bool
-}
+// configValue formats a decoded YAML scalar the way it would be passed on
+// the command line.
+func configValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Groups files read from the home directory.
+const (
+	defaultExcludedGroupsFile = ".get-resources-excluded-groups"
+	includedGroupsFile        = ".get-resources-included-groups"
+)
+
+// excludedGroupsFileEnv is the environment variable that moves the
+// excluded-groups file, like --excluded-groups-file.
+const excludedGroupsFileEnv = "GET_RESOURCES_EXCLUDED_GROUPS_FILE"
+
+// homePath returns filename in the user's home directory, or "" if the home
+// directory is unknown.
+func homePath(filename string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.Printf("Warning: can't get user home directory: %v", err)
+		return ""
+	}
+	return filepath.Join(home, filename)
+}
+
+// getExcludedGroups reads the excluded-groups file. Besides bare group names
+// it accepts group/resource and group/version/resource entries, which are
+// stored by their resourceExclusion key.
+func getExcludedGroups(path string) map[string]bool {
+	excludedGroups := make(map[string]bool)
+	groups, _ := readGroupsFile(path)
+	for _, group := range groups {
+		if !strings.Contains(group, "/") {
+			excludedGroups[group] = true
+			continue
+		}
+		key, err := resourceExclusion(group)
+		if err != nil {
+			log.Printf("Warning: ignoring %q in %s: %v", group, path, err)
+			continue
+		}
+		excludedGroups[key] = true
+	}
+	return excludedGroups
+}
+
+// resourceExclusion normalizes a group/resource or group/version/resource
+// exclusion to the key isResourceExcluded looks up, mapping "core" to the
+// core group: core/v1/events becomes "/v1/events".
+func resourceExclusion(entry string) (string, error) {
+	parts := strings.Split(entry, "/")
+	if len(parts) > 3 {
+		return "", errors.New("too many segments")
+	}
+	for _, part := range parts {
+		if part == "" {
+			return "", errors.New("empty segment")
+		}
+	}
+	if parts[0] == "core" {
+		parts[0] = ""
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// isResourceExcluded reports whether excluded holds a group/resource or
+// group/version/resource key for gvr. A subresource is excluded with its
+// parent resource.
+func isResourceExcluded(excluded map[string]bool, gvr schema.GroupVersionResource) bool {
+	resource, _, _ := strings.Cut(gvr.Resource, "/")
+	return excluded[gvr.Group+"/"+resource] || excluded[gvr.Group+"/"+gvr.Version+"/"+resource]
+}
+
+// getIncludedGroups reads the groups to restrict the collection to, with
+// "core" standing for the core group. It returns nil, meaning every group,
+// if the file doesn't exist or lists nothing.
+func getIncludedGroups(path string) map[string]bool {
+	groups, _ := readGroupsFile(path)
+	return groupSet(groups)
+}
+
+// readGroupsFile reads one group per line from path, skipping blank lines and
+// # comments. found is false if the file doesn't exist.
+func readGroupsFile(path string) (groups []string, found bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		// File not found
+		return nil, false
+	}
+	defer f.Close()
+
+	groups, err = readLines(f)
+	if err != nil {
+		log.Printf("Warning: error reading groups file %s: %v", path, err)
+	}
+	return groups, true
+}
+
+// readNamespacesFrom reads the namespaces of --namespaces-from, one per line
+// like the groups files, from path or stdin if it is "-".
+func readNamespacesFrom(path string) ([]string, error) {
+	r, source := io.Reader(os.Stdin), "stdin"
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r, source = f, path
+	}
+	namespaces, err := readLines(r)
+	if err != nil {
+		return nil, err
+	}
+	// No namespace at all would select every resource instead of none.
+	if len(namespaces) == 0 {
+		return nil, fmt.Errorf("no namespaces in %s", source)
+	}
+	return namespaces, nil
+}
+
+// readLines returns the lines of r, trimmed, without blank lines and #
+// comments.
+func readLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+func processResources(ctx context.Context, dyn dynamic.Interface, disc discovery.DiscoveryInterface, filter ResourceFilter, printer resourcePrinter, namespaces []string, includeCluster bool, processNamespacedResources bool) {
+	// Discover resources
+	apiResources, err := discoverResources(disc, filter.Context, filter.AllVersions)
+	if err != nil && filter.Context != "" {
+		// One unreachable cluster doesn't stop the collection of the others.
+		log.Printf("Warning: skipping context %s, failed to discover resources: %v", filter.Context, err)
+		errorLog.record(errorLogEntry{Operation: "discovery", Context: filter.Context}, err)
+		listFailures.add(listFailure{scope: "context " + filter.Context, err: err})
+		return
+	}
+	if err != nil {
+		fatalf(exitCodeFor(err, exitDiscovery), "Failed to discover resources: %v", err)
+	}
+
+	if !filter.SinceEvent.IsZero() && !filter.DryRun {
+		filter.EventObjects = listEventObjects(ctx, dyn, namespaces, filter)
+	}
+	if filter.Validate && !filter.DryRun {
+		filter.Validator, err = newObjectValidator(disc)
+		if err != nil {
+			log.Printf("Warning: not validating objects: %v", err)
+		}
+	}
+
+	if len(filter.ResourceNames) > 0 {
+		filter.Resources, err = resolveResources(disc, filter.ResourceNames)
+		if err != nil {
+			fatalf(exitUsage, "Invalid --resources: %v", err)
+		}
+	}
+
+	planned := planJobs(apiResources, filter, includeCluster, processNamespacedResources)
+	if filter.OnlyCRDs {
+		planned = onlyCustomResources(ctx, dyn, planned, filter)
+	}
+	planned = skipUnavailableAPIs(ctx, dyn, planned, filter)
+	summary.setPlan(countResourceTypes(apiResources), len(planned), countSkipped(apiResources, planned))
+	if filter.DryRun {
+		if err := printPlan(os.Stdout, planned, namespaces); err != nil {
+			fatalf(exitUsage, "Failed to write output: %v", err)
+		}
+		return
+	}
+	if filter.Watch {
+		watchResources(ctx, dyn, planned, filter, namespaces, printer)
+		return
+	}
+
+	dedupe, _ := printer.(*dedupePrinter)
+	dedupe.plan(filter.Context, planned)
+	progress.addPlanned(len(planned))
+	jobs := make(chan listJob)
+	var wg sync.WaitGroup
+	for i := 0; i < filter.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				listResource(ctx, dyn, job, filter, namespaces, printer)
+				dedupe.listed(filter.Context, job.gvr)
+			}
+		}()
+	}
+	for _, job := range planned {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- job
+	}
+	close(jobs)
+	wg.Wait()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		log.Println("Timed out before all resources were collected (see --timeout).")
+	}
+}
+
+// discoverResources returns the server's preferred resources, or with
+// allVersions the resources of every served version. Groups that failed
+// discovery, typically an aggregated API whose backing service is down, are
+// logged and skipped so the rest of the cluster is still collected.
+func discoverResources(disc discovery.DiscoveryInterface, kubeContext string, allVersions bool) ([]*metav1.APIResourceList, error) {
+	var apiResources []*metav1.APIResourceList
+	var err error
+	if allVersions {
+		_, apiResources, err = disc.ServerGroupsAndResources()
+	} else {
+		apiResources, err = disc.ServerPreferredResources()
+	}
+	var failed *discovery.ErrGroupDiscoveryFailed
+	if err != nil && errors.As(err, &failed) && len(apiResources) > 0 {
+		groups := make([]schema.GroupVersion, 0, len(failed.Groups))
+		for gv := range failed.Groups {
+			groups = append(groups, gv)
+		}
+		sort.Slice(groups, func(i, j int) bool { return groups[i].String() < groups[j].String() })
+		for _, gv := range groups {
+			reportUnavailableAPI(gv, kubeContext, fmt.Errorf("discovery failed: %v", failed.Groups[gv]))
+		}
+		return apiResources, nil
+	}
+	return apiResources, err
+}
+
+// planJobs selects the discovered resource types to list, honoring the
+// excluded groups and the group, kind and scope filters.
+func planJobs(apiResources []*metav1.APIResourceList, filter ResourceFilter, includeCluster bool, processNamespacedResources bool) []listJob {
+	excludedFile := filter.ExcludedGroupsFile
+	if excludedFile == "" {
+		excludedFile = homePath(defaultExcludedGroupsFile)
+	}
+	excludedGroups := getExcludedGroups(excludedFile)
+	includedGroups := getIncludedGroups(homePath(includedGroupsFile))
+	if filter.IncludeEvents {
+		delete(excludedGroups, "events.k8s.io")
+	}
+	for group := range filter.ExcludeGroups {
+		excludedGroups[group] = true
+	}
+	for key := range filter.ExcludeResources {
+		excludedGroups[key] = true
+	}
+	// Groups requested on the command line win over the excluded-groups file
+	for group := range filter.Groups {
+		delete(excludedGroups, group)
+	}
+
+	var jobs []listJob
+	for _, group := range apiResources {
+		gv, err := schema.ParseGroupVersion(group.GroupVersion)
+		if err != nil {
+			continue
+		}
+
+		if excludedGroups[gv.Group] {
+			vlogf(logSkipped, "Skipping excluded group %s", group.GroupVersion)
+			continue
+		}
+		if filter.Groups != nil && !filter.Groups[gv.Group] {
+			vlogf(logSkipped, "Skipping group %s not selected by --group", group.GroupVersion)
+			continue
+		}
+		if filter.Groups == nil && includedGroups != nil && !includedGroups[gv.Group] {
+			vlogf(logSkipped, "Skipping group %s not listed in the included-groups file", group.GroupVersion)
+			continue
+		}
+
+		for _, resource := range group.APIResources {
+			// Skip subresources like "pods/status" unless requested. Only those
+			// that can be read with get are collectable at all.
+			if strings.Contains(resource.Name, "/") && (!filter.IncludeSubresources || !contains(resource.Verbs, "get")) {
+				continue
+			}
+
+			// Skip corev1 events
+			if !filter.IncludeEvents && gv.Group == "" && gv.Version == "v1" && (resource.Name == "events" || resource.Kind == "Event") {
+				continue
+			}
+
+			if filter.Resources != nil && !filter.Resources[schema.GroupResource{Group: gv.Group, Resource: strings.Split(resource.Name, "/")[0]}] {
+				continue
+			}
+			if filter.Kinds != nil && !matchesKind(filter.Kinds, resource) {
+				continue
+			}
+			if matchesKind(filter.ExcludeKinds, resource) {
+				continue
+			}
+
+			gvr := schema.GroupVersionResource{Group: gv.Group, Version: gv.Version, Resource: resource.Name}
+			if isResourceExcluded(excludedGroups, gvr) {
+				vlogf(logSkipped, "Skipping excluded resource %s", describeGVR(gvr))
+				continue
+			}
 
-func init() {
-	flag.Usage = func() {
-		cmd := filepath.Base(os.Args[0])
-		if strings.HasPrefix(cmd, "kubectl") {
-			cmd = strings.Replace(cmd, "-", " ", 1)
-			cmd = strings.Replace(cmd, "_", "-", 1)
+			if filter.Watch && !contains(resource.Verbs, "watch") {
+				vlogf(logSkipped, "Skipping %s, it doesn't support watch", describeGVR(gvr))
+				continue
+			}
+
+			if (resource.Namespaced && processNamespacedResources) || (!resource.Namespaced && includeCluster) {
+				jobs = append(jobs, listJob{gvr: gvr, namespaced: resource.Namespaced})
+			}
 		}
+	}
+	return jobs
+}
 
-		example := func(args string) string {
-			if args == "" {
-				return cmd
+// printPlan writes the resource types a run would list and where.
+func printPlan(out io.Writer, jobs []listJob, namespaces []string) error {
+	w := tabwriter.NewWriter(out, 10, 4, 3, ' ', 0)
+	fmt.Fprintln(w, "GROUPVERSION\tRESOURCE\tNAMESPACED\tNAMESPACES")
+	for _, job := range jobs {
+		scope := "<cluster>"
+		if job.namespaced {
+			scope = "<all>"
+			if namespaces != nil && !(len(namespaces) == 1 && namespaces[0] == "*") {
+				scope = strings.Join(namespaces, ",")
 			}
-			return fmt.Sprintf("%s %s", cmd, args)
 		}
+		fmt.Fprintf(w, "%s\t%s\t%t\t%s\n", job.gvr.GroupVersion(), job.gvr.Resource, job.namespaced, scope)
+	}
+	return w.Flush()
+}
 
-		message := "Get resources from the K8s/OpenShift cluster. Note: all flags are optional.\n\n" + "Flags:\n"
+// listJob is a single resource type to be listed by a worker.
+type listJob struct {
+	gvr        schema.GroupVersionResource
+	namespaced bool
+}
 
-		fmt.Fprintf(flag.CommandLine.Output(), "%s", message)
-		flag.PrintDefaults()
+// listResource lists every object of the job's resource type, across the
+// requested namespaces for namespaced resources, and outputs them. A
+// subresource such as pods/status can't be listed, so its parent resource is
+// listed instead and the subresource fetched for every parent object.
+func listResource(ctx context.Context, dyn dynamic.Interface, job listJob, filter ResourceFilter, namespaces []string, printer resourcePrinter) {
+	gvr := job.gvr
+	progress.listing(describeGVR(gvr))
+	defer progress.listed()
+	listGVR, subresource := gvr, ""
+	if parent, sub, ok := strings.Cut(gvr.Resource, "/"); ok {
+		listGVR.Resource, subresource = parent, sub
+	}
+	allNamespaces := namespaces == nil || (len(namespaces) == 1 && namespaces[0] == "*")
+	// A --name of the resource types given is fetched instead of listing
+	// them, except across all namespaces or when selectors apply that a Get
+	// ignores.
+	getByName := filter.Name != "" && (len(filter.Kinds) > 0 || len(filter.Resources) > 0) &&
+		(!job.namespaced || !allNamespaces) && filter.LabelSelector == "" && filter.FieldSelector == ""
+	var listed atomic.Int64
+	output := func(items []unstructured.Unstructured) {
+		listed.Add(int64(len(items)))
+		if subresource != "" {
+			items = getSubresources(ctx, dyn, listGVR, subresource, items, filter.RequestTimeout, filter.Context)
+		}
+		filterAndOutput(items, gvr, filter, printer)
+	}
+	// list lists one scope and reports whether to go on with the next, i.e.
+	// the --max-objects-per-resource cap of the resource isn't reached.
+	list := func(ri dynamic.ResourceInterface, scope string) bool {
+		scoped := filter
+		if filter.MaxObjectsPerResource > 0 {
+			scoped.MaxObjectsPerResource -= listed.Load()
+		}
+		var err error
+		switch {
+		case getByName:
+			err = getNamed(ctx, ri, scoped, output)
+		case filter.MaxObjectsPerResource > 0 && scoped.MaxObjectsPerResource <= 0:
+			err = errObjectCap
+		default:
+			err = listPages(ctx, ri, scoped, output)
+		}
+		if errors.Is(err, errObjectCap) {
+			log.Printf("Warning: stopped listing %s after %d objects (--max-objects-per-resource)", describeGVR(gvr), listed.Load())
+			return false
+		}
+		if err != nil {
+			reportListError(gvr, scope, filter.Context, err)
+		}
+		return true
+	}
 
-		fmt.Fprintln(flag.CommandLine.Output(), `
-Examples:
-  Get all resources (namespaced + cluster resources)
-  `+example("")+`
+	if !job.namespaced {
+		vlogf(logProgress, "Listing %s", describeGVR(gvr))
+		list(dyn.Resource(listGVR), "")
+		return
+	}
 
-  Get only cluster-scoped resources
-  `+example(`--namespace=""`)+`
+	if allNamespaces {
+		// List all namespaces
+		vlogf(logProgress, "Listing %s in all namespaces", describeGVR(gvr))
+		list(dyn.Resource(listGVR).Namespace(metav1.NamespaceAll), " in all namespaces")
+		return
+	}
 
-  Get only all namespaced resources
-  `+example(`--namespace="*" --exclude-cluster-resources=true`)+`
+	// List selected namespaces, with --namespace-workers at a time. The
+	// --max-objects-per-resource budget is spent namespace after namespace,
+	// so a capped resource is listed one namespace at a time.
+	workers := min(filter.NamespaceWorkers, len(namespaces))
+	if filter.MaxObjectsPerResource > 0 {
+		workers = 1
+	}
+	if workers <= 1 {
+		for _, ns := range namespaces {
+			if ctx.Err() != nil {
+				return
+			}
+			vlogf(logProgress, "Listing %s in namespace %s", describeGVR(gvr), ns)
+			if !list(dyn.Resource(listGVR).Namespace(ns), " in namespace "+ns) {
+				return
+			}
+		}
+		return
+	}
+	nsCh := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ns := range nsCh {
+				vlogf(logProgress, "Listing %s in namespace %s", describeGVR(gvr), ns)
+				list(dyn.Resource(listGVR).Namespace(ns), " in namespace "+ns)
+			}
+		}()
+	}
+	for _, ns := range namespaces {
+		if ctx.Err() != nil {
+			break
+		}
+		nsCh <- ns
+	}
+	close(nsCh)
+	wg.Wait()
+}
 
-  Get specific namespace resources
-  `+example(`--namespace=default`)+`
+// getSubresources fetches the subresource of every parent object. Objects
+// whose subresource can't be read are skipped.
+func getSubresources(ctx context.Context, dyn dynamic.Interface, parent schema.GroupVersionResource, subresource string, items []unstructured.Unstructured, timeout time.Duration, kubeContext string) []unstructured.Unstructured {
+	var result []unstructured.Unstructured
+	for _, item := range items {
+		if ctx.Err() != nil {
+			break
+		}
+		reqCtx, cancel := requestContext(ctx, timeout)
+		obj, err := dyn.Resource(parent).Namespace(item.GetNamespace()).Get(reqCtx, item.GetName(), metav1.GetOptions{}, subresource)
+		cancel()
+		if err != nil {
+			vlogf(logSkipped, "Skipping %s/%s of %s %s: %v", describeGVR(parent), subresource, item.GetNamespace(), item.GetName(), err)
+			errorLog.record(errorLogEntry{Operation: "get", Context: kubeContext, Group: parent.Group, Version: parent.Version, Resource: parent.Resource + "/" + subresource, Namespace: item.GetNamespace(), Name: item.GetName()}, err)
+			continue
+		}
+		result = append(result, *obj)
+	}
+	return result
+}
 
-  Get multiple namespace resources
-  `+example(`--namespace=default --namespace=sample-namespace`)+`
+// listFailure is a List call that failed and whose objects are missing from
+// the output. A whole context that couldn't be collected has no gvr.
+type listFailure struct {
+	gvr schema.GroupVersionResource
+	// api is the group version that couldn't be collected at all, for an
+	// unavailable API.
+	api   schema.GroupVersion
+	scope string
+	err   error
+}
 
-  Get all resources created before a given time
-  `+example(`--before=2025-08-10T09:39:09Z`)+`
+func (f listFailure) describe() string {
+	if !f.api.Empty() {
+		return f.api.String() + f.scope
+	}
+	if f.gvr.Empty() {
+		return f.scope
+	}
+	return describeGVR(f.gvr) + f.scope
+}
 
-  Get all resources created after a given time
-  `+example(`--after=2025-08-10T09:39:09Z`)+`
+// runSummary collects the statistics written by --summary-json.
+type runSummary struct {
+	mu         sync.Mutex
+	start      time.Time
+	discovered int
+	listed     int
+	skipped    int
+	objects    map[string]int
+	bytes      int64
+	clusters   []map[string]string
+}
 
-  Get all resources between two times
-  `+example(`--start=2025-08-10T09:39:09Z --end=2025-08-10T10:30:02Z`)+`
+// summary is the runSummary of this run.
+var summary = runSummary{start: time.Now(), objects: make(map[string]int)}
 
-  Get 'default' namespace resources after a given time
-  `+example(`--namespace=default --after=2025-08-10T09:39:09Z`)+`
+// setPlan adds the resource types discovered, planned and skipped in a
+// cluster.
+func (s *runSummary) setPlan(discovered, listed, skipped int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.discovered += discovered
+	s.listed += listed
+	s.skipped += skipped
+}
 
-  Get resource details added in CSV output
-  `+example(`--namespace=default --after=2025-08-10T09:39:09Z --resource-data=true`)+`
+func (s *runSummary) addObject(group string) {
+	if group == "" {
+		group = "core"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[group]++
+}
 
-  Save all output YAMLs to a directory
-  `+example(`--output=<Your directory name>`)+`
+// objectCount returns the number of objects output so far.
+func (s *runSummary) objectCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := 0
+	for _, n := range s.objects {
+		total += n
+	}
+	return total
+}
 
-  Save 'default' namespace resources in directory 'default_namespace_resources'
-  `+example(`--namespace=default --output=default_namespace_resources`)+`
+// addCluster records a cluster collected from, for snapshot.json.
+func (s *runSummary) addCluster(kubeContext, serverVersion string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clusters = append(s.clusters, map[string]string{"context": kubeContext, "serverVersion": serverVersion})
+}
 
-  Notes:
-  (1) Flags --resource-data and --output are mutually exclusive
-  (2) Exclude specific group(s) from retrieval by listing them in the hidden file .get-resources-excluded-groups in user's HOME directory.
-      Each group should be written on a separate line. Lines starting with a hash (#) are treated as comments and ignored.
-      Commonly excluded groups are:
-      $ cat ~/.get-resources-excluded-groups
-        events.k8s.io
-        metrics.k8s.io
-        image.openshift.io
-        packages.operators.coreos.com
-`)
-	}
+func (s *runSummary) addBytes(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bytes += int64(n)
 }
 
-func main() {
-	var namespaces namespaceList
-	var excludeCluster, resourceData bool
-	var beforeStr, afterStr, startStr, endStr, outputDir string
-
-	flag.Var(&namespaces, "namespace", "Namespace(s) to process. Use '*' for all, '' for only cluster resources.")
-	flag.BoolVar(&excludeCluster, "exclude-cluster-resources", false, "Exclude cluster-scoped resources")
-	flag.StringVar(&beforeStr, "before", "", "Only include resources created before this RFC3339 timestamp")
-	flag.StringVar(&afterStr, "after", "", "Only include resources created after this RFC3339 timestamp")
-	flag.StringVar(&startStr, "start", "", "Start time for filtering resources (use with --end)")
-	flag.StringVar(&endStr, "end", "", "End time for filtering resources (use with --start)")
-	flag.StringVar(&outputDir, "output", "", "Directory to save collected resource YAMLs")
-	flag.BoolVar(&resourceData, "resource-data", false, "Add resource details in CSV output")
-
-	flag.Parse()
-
-	filter, err := validateAndBuildFilter(beforeStr, afterStr, startStr, endStr, outputDir, resourceData)
+// write saves the summary as JSON to path.
+func (s *runSummary) write(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := 0
+	for _, n := range s.objects {
+		total += n
+	}
+	data, err := json.MarshalIndent(map[string]interface{}{
+		"startTime":               s.start.UTC().Format(time.RFC3339),
+		"durationSeconds":         time.Since(s.start).Seconds(),
+		"resourceTypesDiscovered": s.discovered,
+		"resourceTypesListed":     s.listed,
+		"resourceTypesSkipped":    s.skipped,
+		"listFailures":            listFailures.count(),
+		"objectsByGroup":          s.objects,
+		"objectsTotal":            total,
+		"bytesWritten":            s.bytes,
+	}, "", "  ")
 	if err != nil {
-		log.Fatalf("Flag validation error: %v", err)
+		return err
 	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
 
-	// Init K8s clients
-	kubeconfig := filepath.Join(os.Getenv("HOME"), ".kube", "config")
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+// writeSnapshot saves snapshot.json to an --output-dir, recording where and
+// when the dump was taken and how, so an archived dump documents itself.
+func (s *runSummary) writeSnapshot(dir string, args []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	total := 0
+	for _, n := range s.objects {
+		total += n
+	}
+	data, err := json.MarshalIndent(map[string]interface{}{
+		"startTime":    s.start.UTC().Format(time.RFC3339),
+		"endTime":      time.Now().UTC().Format(time.RFC3339),
+		"clusters":     s.clusters,
+		"args":         args,
+		"version":      versionString(),
+		"objectsTotal": total,
+		"listFailures": listFailures.count(),
+	}, "", "  ")
 	if err != nil {
-		log.Fatalf("Failed to load kubeconfig: %v", err)
+		return err
 	}
-	dynClient, _ := dynamic.NewForConfig(config)
-	discClient, _ := discovery.NewDiscoveryClientForConfig(config)
+	return os.WriteFile(filepath.Join(dir, snapshotFileName), append(data, '\n'), 0644)
+}
 
-	if resourceData {
-		fmt.Println("kind,plural,apiversion,namespace,name,creationtimestamp,data")
-	} else if outputDir == "" {
-		fmt.Println("kind,plural,apiversion,namespace,name,creationtimestamp")
+// countResourceTypes counts the discovered resource types, without their
+// subresources.
+func countResourceTypes(apiResources []*metav1.APIResourceList) int {
+	n := 0
+	for _, list := range apiResources {
+		for _, resource := range list.APIResources {
+			if !strings.Contains(resource.Name, "/") {
+				n++
+			}
+		}
 	}
+	return n
+}
 
-	// Decision logic
-	switch {
-	case len(namespaces) == 0:
-		if excludeCluster {
-			fmt.Println("Nothing to process: no namespaces and cluster excluded")
-			os.Exit(0)
+// countSkipped counts the discovered resource types, without their
+// subresources, that planned doesn't list. Subresources and other versions
+// planned with --include-subresources or --all-versions don't offset them.
+func countSkipped(apiResources []*metav1.APIResourceList, planned []listJob) int {
+	listed := make(map[schema.GroupVersionResource]bool, len(planned))
+	for _, job := range planned {
+		listed[job.gvr] = true
+	}
+	n := 0
+	for _, list := range apiResources {
+		gv, _ := schema.ParseGroupVersion(list.GroupVersion)
+		for _, resource := range list.APIResources {
+			if !strings.Contains(resource.Name, "/") && !listed[gv.WithResource(resource.Name)] {
+				n++
+			}
 		}
-		processAllResources(dynClient, discClient, filter)
+	}
+	return n
+}
 
-	case len(namespaces) == 1 && namespaces[0] == "":
-		processOnlyClusterResources(dynClient, discClient, filter)
+// failureLog collects list failures from all workers for the end-of-run
+// summary.
+type failureLog struct {
+	mu       sync.Mutex
+	failures []listFailure
+}
 
-	case contains(namespaces, "*"):
-		if excludeCluster {
-			processOnlyNamespaces(dynClient, discClient, filter, []string{"*"})
-		} else {
-			processAllResources(dynClient, discClient, filter)
+// listFailures records every failed List of this run.
+var listFailures failureLog
+
+func (l *failureLog) add(f listFailure) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.failures = append(l.failures, f)
+}
+
+func (l *failureLog) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.failures)
+}
+
+// contextFailures counts the contexts skipped since their discovery failed.
+func (l *failureLog) contextFailures() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, f := range l.failures {
+		if f.gvr.Empty() && f.api.Empty() {
+			n++
 		}
+	}
+	return n
+}
 
-	default:
-		if excludeCluster {
-			processOnlyNamespaces(dynClient, discClient, filter, namespaces)
-		} else {
-			processNamespacesAndCluster(dynClient, discClient, filter, namespaces)
+// printSummary logs the failed lists, separating RBAC denials from other
+// (usually transient) errors.
+func (l *failureLog) printSummary() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.failures) == 0 {
+		return
+	}
+	// An unavailable aggregated API is reported once, not for every
+	// resource it serves.
+	var forbidden, unavailable, other []listFailure
+	for _, f := range l.failures {
+		switch {
+		case apierrors.IsForbidden(f.err):
+			forbidden = append(forbidden, f)
+		case !f.api.Empty() || apierrors.IsServiceUnavailable(f.err):
+			unavailable = append(unavailable, f)
+		default:
+			other = append(other, f)
 		}
 	}
+	log.Printf("Some resources were skipped because listing them failed (%d forbidden, %d unavailable, %d other errors):", len(forbidden), len(unavailable), len(other))
+	for _, f := range forbidden {
+		log.Printf("  forbidden: %s", f.describe())
+	}
+	for _, f := range unavailable {
+		log.Printf("  unavailable: %s: %v", f.describe(), f.err)
+	}
+	for _, f := range other {
+		log.Printf("  error: %s: %v", f.describe(), f.err)
+	}
 }
 
-// Validation and Filtering
-func validateAndBuildFilter(beforeStr, afterStr, startStr, endStr, output string, resourceData bool) (ResourceFilter, error) {
-	var filter ResourceFilter
-	var err error
+// reportListError records a failed List. Timeouts are logged right away since
+// they usually point at an overloaded apiserver; other errors only with
+// -v, the summary at the end lists them all. kubeContext is set when
+// collecting from several contexts.
+func reportListError(gvr schema.GroupVersionResource, scope, kubeContext string, err error) {
+	// The requests cut short by an interrupt aren't failures of their own,
+	// run reports the interrupt once.
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	namespace, _ := strings.CutPrefix(scope, " in namespace ")
+	if scope == " in all namespaces" {
+		namespace = "*"
+	}
+	errorLog.record(errorLogEntry{Operation: "list", Context: kubeContext, Group: gvr.Group, Version: gvr.Version, Resource: gvr.Resource, Namespace: namespace}, err)
+	if kubeContext != "" {
+		scope += " in context " + kubeContext
+	}
+	listFailures.add(listFailure{gvr: gvr, scope: scope, err: err})
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Printf("Timed out listing %s%s", describeGVR(gvr), scope)
+		return
+	}
+	vlogf(logSkipped, "Skipping %s%s: %v", describeGVR(gvr), scope, err)
+}
 
-	if beforeStr != "" && afterStr != "" {
-		return filter, errors.New("cannot use both --before and --after")
+// errorLog is the --error-log of this run, nil without one.
+var errorLog *errorLogWriter
+
+// errorLogEntry is a line of the --error-log. Namespace is "*" for a list
+// across all namespaces and empty for cluster-scoped resources, Context is
+// only set when collecting from several contexts.
+type errorLogEntry struct {
+	Time      string `json:"time"`
+	Operation string `json:"operation"`
+	Context   string `json:"context,omitempty"`
+	Group     string `json:"group"`
+	Version   string `json:"version"`
+	Resource  string `json:"resource,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Error     string `json:"error"`
+}
+
+// errorLogWriter appends errorLogEntry lines to a file, each written right
+// away so the log is complete even if the run is interrupted.
+type errorLogWriter struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+func openErrorLog(path string) (*errorLogWriter, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
 	}
-	if (startStr != "" && endStr == "") || (startStr == "" && endStr != "") {
-		return filter, errors.New("--start and --end must be used together")
+	return &errorLogWriter{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// record logs err, filling in the time and the API reason of entry.
+func (l *errorLogWriter) record(entry errorLogEntry, err error) {
+	if l == nil {
+		return
 	}
-	if (beforeStr != "" || afterStr != "") && (startStr != "" || endStr != "") {
-		return filter, errors.New("--before/--after cannot be used with --start/--end")
+	entry.Time = time.Now().UTC().Format(time.RFC3339)
+	entry.Reason = string(apierrors.ReasonForError(err))
+	if entry.Reason == "" && errors.Is(err, context.DeadlineExceeded) {
+		entry.Reason = string(metav1.StatusReasonTimeout)
 	}
+	entry.Error = err.Error()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.enc.Encode(entry); err != nil {
+		log.Printf("Failed to write --error-log: %v", err)
+	}
+}
 
-	if beforeStr != "" {
-		filter.Before, err = time.Parse(time.RFC3339, beforeStr)
-		if err != nil {
-			return filter, fmt.Errorf("invalid --before timestamp: %v", err)
+func (l *errorLogWriter) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// describeGVR formats a resource as "group/version resource", e.g.
+// "apps/v1 deployments".
+func describeGVR(gvr schema.GroupVersionResource) string {
+	return gvr.GroupVersion().String() + " " + gvr.Resource
+}
+
+// maxListRestarts bounds how often a paginated list is restarted after its
+// continue token expired.
+const maxListRestarts = 3
+
+// errObjectCap is returned by listPages when it stopped at
+// filter.MaxObjectsPerResource objects with more left to list.
+var errObjectCap = errors.New("object cap reached")
+
+// listPages lists ri in pages of filter.ChunkSize objects, calling fn for each
+// page so memory stays bounded. If the continue token expires mid-list, the
+// list is restarted from the beginning and objects already passed to fn are
+// skipped. With filter.MaxObjectsPerResource set, no more than that many
+// objects are requested and passed to fn.
+func listPages(ctx context.Context, ri dynamic.ResourceInterface, filter ResourceFilter, fn func([]unstructured.Unstructured)) error {
+	opts := listOptions(filter)
+	limit := filter.MaxObjectsPerResource
+	seen := make(map[string]bool)
+	// passed counts the objects given to fn, which the cap applies to.
+	var passed int64
+	restarts := 0
+	for {
+		if limit > 0 {
+			opts.Limit = filter.ChunkSize
+			if remaining := limit - passed; opts.Limit == 0 || remaining < opts.Limit {
+				opts.Limit = remaining
+			}
 		}
-	}
-	if afterStr != "" {
-		filter.After, err = time.Parse(time.RFC3339, afterStr)
+		list, err := listPageWithRetry(ctx, ri, opts, filter)
 		if err != nil {
-			return filter, fmt.Errorf("invalid --after timestamp: %v", err)
+			if opts.Continue != "" && apierrors.IsResourceExpired(err) && restarts < maxListRestarts {
+				vlogf(logSkipped, "Continue token expired, restarting list: %v", err)
+				opts.Continue = ""
+				restarts++
+				continue
+			}
+			return err
 		}
-	}
-	if startStr != "" {
-		filter.Start, err = time.Parse(time.RFC3339, startStr)
-		if err != nil {
-			return filter, fmt.Errorf("invalid --start timestamp: %v", err)
+
+		items := make([]unstructured.Unstructured, 0, len(list.Items))
+		capped := false
+		for _, item := range list.Items {
+			if limit > 0 && passed >= limit {
+				capped = true
+				break
+			}
+			// Only a restarted list repeats objects; some kinds, such as
+			// componentstatuses or metrics, come without a UID.
+			key := listedObjectKey(&item)
+			if restarts > 0 && seen[key] {
+				continue
+			}
+			seen[key] = true
+			items = append(items, item)
+			passed++
 		}
-		filter.End, err = time.Parse(time.RFC3339, endStr)
-		if err != nil {
-			return filter, fmt.Errorf("invalid --end timestamp: %v", err)
+		fn(items)
+
+		opts.Continue = list.GetContinue()
+		if limit > 0 && passed >= limit && (capped || opts.Continue != "") {
+			return errObjectCap
+		}
+		if opts.Continue == "" {
+			return nil
 		}
 	}
+}
 
-	if resourceData && output != "" {
-		return filter, errors.New("--resource-data and --output are mutually exclusive")
+// listedObjectKey identifies an object of a list by its UID, or by its
+// namespace and name if it has none.
+func listedObjectKey(item *unstructured.Unstructured) string {
+	if uid := item.GetUID(); uid != "" {
+		return string(uid)
 	}
+	return item.GetNamespace() + "/" + item.GetName()
+}
 
-	filter.OutputDir = output
-	filter.ResourceData = resourceData
-	return filter, nil
+// getNamed fetches the object named filter.Name and passes it to fn. It
+// not existing in the scope of ri isn't an error.
+func getNamed(ctx context.Context, ri dynamic.ResourceInterface, filter ResourceFilter, fn func([]unstructured.Unstructured)) error {
+	ctx, cancel := requestContext(ctx, filter.RequestTimeout)
+	defer cancel()
+	item, err := ri.Get(ctx, filter.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fn([]unstructured.Unstructured{*item})
+	return nil
 }
 
-func contains(list []string, val string) bool {
-	for _, v := range list {
-		if v == val {
-			return true
+// Backoff between retries of a transient List failure.
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+)
+
+// listPageWithRetry fetches a page, retrying transient failures with
+// exponential backoff up to filter.MaxRetries times. A Retry-After sent by
+// the apiserver takes precedence over the computed delay.
+func listPageWithRetry(ctx context.Context, ri dynamic.ResourceInterface, opts metav1.ListOptions, filter ResourceFilter) (*unstructured.UnstructuredList, error) {
+	for attempt := 0; ; attempt++ {
+		list, err := listPage(ctx, ri, opts, filter.RequestTimeout)
+		if err == nil || attempt >= filter.MaxRetries || !isRetryable(err) || ctx.Err() != nil {
+			return list, err
+		}
+
+		delay := retryMaxDelay
+		if attempt < 16 {
+			delay = min(retryBaseDelay<<attempt, retryMaxDelay)
+		}
+		if seconds, ok := apierrors.SuggestsClientDelay(err); ok {
+			delay = time.Duration(seconds) * time.Second
+		}
+		vlogf(logSkipped, "Retrying List in %s (attempt %d of %d): %v", delay, attempt+1, filter.MaxRetries, err)
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
 		}
 	}
-	return false
 }
 
-// Different Processing functions
-func processAllResources(dyn dynamic.Interface, disc *discovery.DiscoveryClient, filter ResourceFilter) {
-	processResources(dyn, disc, filter, nil, true, true) // nil = all namespaces
+// isRetryable reports whether a List error is likely transient. Permission
+// and not-found errors, and our own request timeout, are not retried.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if apierrors.IsServerTimeout(err) || apierrors.IsTooManyRequests(err) || apierrors.IsTimeout(err) || apierrors.IsServiceUnavailable(err) {
+		return true
+	}
+	if _, isStatus := err.(apierrors.APIStatus); isStatus {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || utilnet.IsConnectionReset(err) || utilnet.IsConnectionRefused(err) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// listPage fetches a single page, bounded by timeout when it is non-zero.
+func listPage(ctx context.Context, ri dynamic.ResourceInterface, opts metav1.ListOptions, timeout time.Duration) (*unstructured.UnstructuredList, error) {
+	ctx, cancel := requestContext(ctx, timeout)
+	defer cancel()
+	return ri.List(ctx, opts)
 }
 
-func processNamespacesAndCluster(dyn dynamic.Interface, disc *discovery.DiscoveryClient, filter ResourceFilter, namespaces []string) {
-	processResources(dyn, disc, filter, namespaces, true, true)
+// requestContext derives the context of a single API request, bounded by
+// timeout when it is non-zero.
+func requestContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
 }
 
-func processOnlyNamespaces(dyn dynamic.Interface, disc *discovery.DiscoveryClient, filter ResourceFilter, namespaces []string) {
-	processResources(dyn, disc, filter, namespaces, false, true)
+// listOptions returns the server-side list options derived from the filter.
+func listOptions(filter ResourceFilter) metav1.ListOptions {
+	return metav1.ListOptions{LabelSelector: filter.LabelSelector, FieldSelector: filter.FieldSelector, Limit: filter.ChunkSize}
 }
 
-func processOnlyClusterResources(dyn dynamic.Interface, disc *discovery.DiscoveryClient, filter ResourceFilter) {
-	processResources(dyn, disc, filter, nil, true, false)
+// hasTimeBounds reports whether any of the time filters is set.
+func (f ResourceFilter) hasTimeBounds() bool {
+	return !f.Before.IsZero() || !f.After.IsZero() || !f.Start.IsZero()
 }
 
-func getExcludedGroups(filename string) map[string]bool {
-	excludedGroups := make(map[string]bool)
-	home, err := os.UserHomeDir()
+// objectTime returns the timestamp the time filters compare: the creation
+// timestamp, or the RFC3339 string at field if --time-field was given.
+func objectTime(item *unstructured.Unstructured, field []string) (time.Time, error) {
+	if field == nil {
+		return item.GetCreationTimestamp().Time, nil
+	}
+	value, found, err := unstructured.NestedString(item.Object, field...)
 	if err != nil {
-		log.Printf("Warning: can't get user home directory: %v", err)
-		return excludedGroups
+		return time.Time{}, err
 	}
-
-	filepath := filepath.Join(home, filename)
-	f, err := os.Open(filepath)
+	if !found {
+		return time.Time{}, fmt.Errorf("--time-field .%s not set", strings.Join(field, "."))
+	}
+	t, err := time.Parse(time.RFC3339, value)
 	if err != nil {
-		// File not found, return empty map
-		return excludedGroups
+		return time.Time{}, fmt.Errorf("--time-field .%s: %v", strings.Join(field, "."), err)
 	}
-	defer f.Close()
+	return t, nil
+}
 
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+// parseFieldPath splits a JSONPath-like field such as
+// .metadata.annotations.example\.com/updated into its keys. A backslash
+// escapes a dot that is part of a key.
+func parseFieldPath(value string) ([]string, error) {
+	if !strings.HasPrefix(value, ".") {
+		return nil, fmt.Errorf("%q must start with '.'", value)
+	}
+	var fields []string
+	var key strings.Builder
+	for i := 1; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '\\' && i+1 < len(value) && value[i+1] == '.':
+			key.WriteByte('.')
+			i++
+		case c == '.':
+			if key.Len() == 0 {
+				return nil, fmt.Errorf("%q has an empty key", value)
+			}
+			fields = append(fields, key.String())
+			key.Reset()
+		default:
+			key.WriteByte(c)
 		}
-		excludedGroups[line] = true
 	}
-	if err := scanner.Err(); err != nil {
-		log.Printf("Warning: error reading excluded file %s: %v", filepath, err)
+	if key.Len() == 0 {
+		return nil, fmt.Errorf("%q has an empty key", value)
 	}
-	return excludedGroups
+	return append(fields, key.String()), nil
 }
 
-func processResources(dyn dynamic.Interface, disc *discovery.DiscoveryClient, filter ResourceFilter, namespaces []string, includeCluster bool, processNamespacedResources bool) {
-	// Discover resources
-	apiResources, err := disc.ServerPreferredResources()
-	if err != nil {
-		log.Fatalf("Failed to discover resources: %v", err)
+// inTimeRange reports whether a timestamp passes the time filters. Lower
+// bounds are inclusive and --before is exclusive: --after=T keeps objects
+// stamped at or after T, --before=T those stamped strictly before T, and
+// --start/--end is the closed range [start, end].
+func inTimeRange(t time.Time, filter ResourceFilter) bool {
+	if !filter.Before.IsZero() && !t.Before(filter.Before) {
+		return false
+	}
+	if !filter.After.IsZero() && t.Before(filter.After) {
+		return false
 	}
+	if !filter.Start.IsZero() && (t.Before(filter.Start) || t.After(filter.End)) {
+		return false
+	}
+	return true
+}
 
-	excludedGroups := getExcludedGroups(".get-resources-excluded-groups")
+// forApplyFields are the metadata fields --for-apply removes, on top of
+// managedFields and status.
+var forApplyFields = []string{"resourceVersion", "uid", "generation", "creationTimestamp", "selfLink"}
 
-	for _, group := range apiResources {
-		gv, err := schema.ParseGroupVersion(group.GroupVersion)
-		if err != nil {
-			continue
+// hasNamespacePatterns reports whether namespaces holds glob patterns such
+// as team-* that need to be matched against the cluster's namespaces. A lone
+// "*" isn't one, it selects all namespaces in a single list.
+func hasNamespacePatterns(namespaces []string) bool {
+	if contains(namespaces, "*") {
+		return false
+	}
+	for _, ns := range namespaces {
+		if strings.ContainsAny(ns, "*?[") {
+			return true
 		}
+	}
+	return false
+}
 
-		if excludedGroups[gv.Group] {
+// expandNamespacePatterns replaces every pattern in namespaces with the
+// names in all that match it, keeping literal names as they are.
+func expandNamespacePatterns(namespaces namespaceList, all []string) namespaceList {
+	var expanded namespaceList
+	for _, ns := range namespaces {
+		if !strings.ContainsAny(ns, "*?[") {
+			if !contains(expanded, ns) {
+				expanded = append(expanded, ns)
+			}
 			continue
 		}
-
-		for _, resource := range group.APIResources {
-			// Skip subresources like "pods/status"
-			if strings.Contains(resource.Name, "/") {
-				continue
+		matched := false
+		for _, name := range all {
+			if ok, _ := path.Match(ns, name); ok {
+				matched = true
+				if !contains(expanded, name) {
+					expanded = append(expanded, name)
+				}
 			}
+		}
+		if !matched {
+			log.Printf("Warning: no namespace matches --namespace pattern %q", ns)
+		}
+	}
+	return expanded
+}
 
-			// Skip corev1 events
-			if gv.Group == "" && gv.Version == "v1" && (resource.Name == "events" || resource.Kind == "Event") {
-				continue
+// dropMissingNamespaces gets each namespace named in namespaces, leaving out
+// "", "*" and patterns, and drops those that don't exist, which would
+// otherwise just yield nothing. With filter.Strict a missing namespace is
+// fatal. Users allowed into a namespace but not to get it are common, so a
+// namespace that can't be checked is kept.
+func dropMissingNamespaces(ctx context.Context, dyn dynamic.Interface, namespaces namespaceList, filter ResourceFilter) namespaceList {
+	var kept namespaceList
+	for _, ns := range namespaces {
+		if ns == "" || ns == "*" || strings.ContainsAny(ns, "*?[") {
+			kept = append(kept, ns)
+			continue
+		}
+		reqCtx, cancel := requestContext(ctx, filter.RequestTimeout)
+		_, err := dyn.Resource(namespacesGVR).Get(reqCtx, ns, metav1.GetOptions{})
+		cancel()
+		switch {
+		case err == nil:
+			kept = append(kept, ns)
+		case apierrors.IsNotFound(err):
+			if filter.Strict {
+				fatalf(exitUsage, "Namespace %s does not exist", ns)
 			}
+			log.Printf("Warning: namespace %s does not exist, skipping it", ns)
+		default:
+			vlogf(logSkipped, "Couldn't check that namespace %s exists: %v", ns, err)
+			kept = append(kept, ns)
+		}
+	}
+	return kept
+}
 
-			gvr := schema.GroupVersionResource{Group: gv.Group, Version: gv.Version, Resource: resource.Name}
-
-			if resource.Namespaced && processNamespacedResources {
-				if namespaces == nil || (len(namespaces) == 1 && namespaces[0] == "*") {
-					// List all namespaces
-					list, err := dyn.Resource(gvr).Namespace(metav1.NamespaceAll).List(context.TODO(), metav1.ListOptions{})
-					if err != nil {
-						continue
-					}
-					filterAndOutput(list.Items, gvr, filter)
-				} else {
-					// List selected namespaces
-					for _, ns := range namespaces {
-						// log.Printf("Listing GVR %s (group=%s, version=%s) in namespace %s", gvr.Resource, gvr.Group, gvr.Version, ns)
-						list, err := dyn.Resource(gvr).Namespace(ns).List(context.TODO(), metav1.ListOptions{})
-						if err != nil {
-							continue
-						}
-						filterAndOutput(list.Items, gvr, filter)
-					}
-				}
-			} else if !resource.Namespaced && includeCluster {
-				list, err := dyn.Resource(gvr).List(context.TODO(), metav1.ListOptions{})
-				if err != nil {
-					continue
-				}
-				filterAndOutput(list.Items, gvr, filter)
-			}
+// namespaceExcluded reports whether ns matches one of the --exclude-namespace
+// patterns. Cluster-scoped objects are never excluded.
+func namespaceExcluded(patterns []string, ns string) bool {
+	if ns == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, ns); ok {
+			return true
 		}
 	}
-	log.Println("Done collecting resources.")
+	return false
 }
 
 // Output and filtering
-func filterAndOutput(items []unstructured.Unstructured, gvr schema.GroupVersionResource, filter ResourceFilter) {
-	csv_writer := csv.NewWriter(os.Stdout)
-	defer csv_writer.Flush()
-	for _, item := range items {
-		created := item.GetCreationTimestamp().Time
-		if !filter.Before.IsZero() && !created.Before(filter.Before) {
+func filterAndOutput(items []unstructured.Unstructured, gvr schema.GroupVersionResource, filter ResourceFilter, printer resourcePrinter) {
+	for i := range items {
+		item := &items[i]
+		if filter.hasTimeBounds() {
+			t, err := objectTime(item, filter.TimeField)
+			if err != nil {
+				vlogf(logSkipped, "Skipping %s %s: %v", gvr.Resource, item.GetName(), err)
+				continue
+			}
+			if !inTimeRange(t, filter) {
+				continue
+			}
+		}
+		if namespaceExcluded(filter.ExcludeNamespaces, item.GetNamespace()) {
 			continue
 		}
-		if !filter.After.IsZero() && !created.After(filter.After) {
+		if filter.EventObjects != nil && !filter.EventObjects.has(item) {
 			continue
 		}
-		if !filter.Start.IsZero() && (created.Before(filter.Start) || created.After(filter.End)) {
+		if filter.Name != "" && item.GetName() != filter.Name {
 			continue
 		}
-
-		out, err := item.MarshalJSON()
-		if err != nil {
-			log.Printf("Error marshalling %s: %v", item.GetName(), err)
+		if filter.NameRegex != nil && !filter.NameRegex.MatchString(item.GetName()) {
 			continue
 		}
-
-		if filter.OutputDir != "" {
-			dir := filepath.Join(filter.OutputDir, item.GetNamespace(), gvr.Resource)
-			_ = os.MkdirAll(dir, 0755)
-			var filename string
-			if strings.HasSuffix(gvr.Group, "openshift.io") {
-				filename = fmt.Sprintf("openshift_%s.yaml", item.GetName())
-			} else {
-				filename = fmt.Sprintf("%s.yaml", item.GetName())
+		if !matchesAnnotations(filter.AnnotationSelector, item.GetAnnotations()) {
+			continue
+		}
+		if filter.Validator != nil {
+			if err := filter.Validator.validate(item); err != nil {
+				reportInvalid(item, gvr, filter.Context, err)
 			}
-			file := filepath.Join(dir, filename)
-			f, err := os.Create(file)
-			if err != nil {
-				log.Printf("Failed to create file: %v", err)
-				continue
+		}
+
+		if filter.StripManagedFields {
+			unstructured.RemoveNestedField(item.Object, "metadata", "managedFields")
+		}
+		if filter.PruneStatus {
+			unstructured.RemoveNestedField(item.Object, "status")
+		}
+		if filter.ForApply {
+			for _, field := range forApplyFields {
+				unstructured.RemoveNestedField(item.Object, "metadata", field)
 			}
-			writeYAML(out, f)
-			f.Close()
-		} else if filter.ResourceData {
-			err = csv_writer.Write([]string{item.GetKind(), gvr.Resource, item.GetAPIVersion(), item.GetNamespace(), item.GetName(), item.GetCreationTimestamp().UTC().Format(time.RFC3339), string(out)})
-		} else {
-			err = csv_writer.Write([]string{item.GetKind(), gvr.Resource, item.GetAPIVersion(), item.GetNamespace(), item.GetName(), item.GetCreationTimestamp().UTC().Format(time.RFC3339)})
 		}
-		if err != nil {
-			log.Println("Failed to write data to CSV writer", err)
+		if filter.RedactSecrets && item.GetKind() == "Secret" {
+			redactSecret(item)
+		}
+
+		if len(filter.Fields) > 0 {
+			item = projectFields(item, filter.Fields)
+		}
+
+		if err := printer.Print(resourceRecord{Item: item, GVR: gvr, Context: filter.Context, Location: filter.Location}); err != nil {
+			log.Printf("Failed to output %s %s: %v", gvr.Resource, item.GetName(), err)
 		}
 	}
 }
 
-func writeYAML(raw []byte, f *os.File) {
-	y := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(raw), 1024)
-	var obj map[string]interface{}
-	_ = y.Decode(&obj)
-
-	scheme := runtime.NewScheme()
-	serializer := json.NewYAMLSerializer(json.DefaultMetaFactory, scheme, scheme)
+// identityFields are kept by --fields so projected objects can still be told
+// apart and saved to their files.
+var identityFields = [][]string{{"apiVersion"}, {"kind"}, {"metadata", "name"}, {"metadata", "namespace"}}
 
-	contentType := runtime.ContentTypeYAML
-	if isJSON(raw) {
-		contentType = runtime.ContentTypeJSON
+// projectFields returns a copy of item holding only the fields at paths and
+// the identityFields. Paths the object doesn't have are left out.
+func projectFields(item *unstructured.Unstructured, paths [][]string) *unstructured.Unstructured {
+	projected := &unstructured.Unstructured{Object: make(map[string]interface{})}
+	for _, fieldPath := range append(identityFields, paths...) {
+		value, found, err := unstructured.NestedFieldCopy(item.Object, fieldPath...)
+		if err != nil || !found {
+			continue
+		}
+		if err := unstructured.SetNestedField(projected.Object, value, fieldPath...); err != nil {
+			vlogf(logSkipped, "Skipping field .%s of %s: %v", strings.Join(fieldPath, "."), item.GetName(), err)
+		}
 	}
-
-	unstructuredObj := &runtime.Unknown{Raw: raw, ContentType: contentType}
-	_ = serializer.Encode(unstructuredObj, f)
+	return projected
 }
 
-func isJSON(data []byte) bool {
-	trimmed := bytes.TrimLeft(data, " \t\r\n")
-	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+// redactSecret replaces every value under data and stringData with a
+// placeholder, keeping the keys so the shape of the Secret is intact. The
+// last-applied-configuration annotation is redacted too since it embeds the
+// full Secret as applied.
+func redactSecret(item *unstructured.Unstructured) {
+	for _, field := range []string{"data", "stringData"} {
+		values, found, err := unstructured.NestedMap(item.Object, field)
+		if err != nil || !found {
+			continue
+		}
+		for key := range values {
+			values[key] = redactedValue
+		}
+		_ = unstructured.SetNestedMap(item.Object, values, field)
+	}
+
+	annotations := item.GetAnnotations()
+	if _, ok := annotations[lastAppliedAnnotation]; ok {
+		annotations[lastAppliedAnnotation] = redactedValue
+		item.SetAnnotations(annotations)
+	}
 }
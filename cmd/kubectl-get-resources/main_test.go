@@ -0,0 +1,407 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestInTimeRange(t *testing.T) {
+	bound := time.Date(2025, 8, 10, 9, 39, 9, 0, time.UTC)
+	end := bound.Add(time.Hour)
+	before := bound.Add(-time.Second)
+	after := bound.Add(time.Second)
+
+	tests := []struct {
+		name   string
+		filter ResourceFilter
+		t      time.Time
+		want   bool
+	}{
+		{"no bounds", ResourceFilter{}, bound, true},
+
+		{"before: earlier", ResourceFilter{Before: bound}, before, true},
+		{"before: at bound is excluded", ResourceFilter{Before: bound}, bound, false},
+		{"before: later", ResourceFilter{Before: bound}, after, false},
+
+		{"after: earlier", ResourceFilter{After: bound}, before, false},
+		{"after: at bound is included", ResourceFilter{After: bound}, bound, true},
+		{"after: later", ResourceFilter{After: bound}, after, true},
+
+		{"after and before: at after", ResourceFilter{After: bound, Before: end}, bound, true},
+		{"after and before: at before", ResourceFilter{After: bound, Before: end}, end, false},
+
+		{"start/end: before start", ResourceFilter{Start: bound, End: end}, before, false},
+		{"start/end: at start is included", ResourceFilter{Start: bound, End: end}, bound, true},
+		{"start/end: inside", ResourceFilter{Start: bound, End: end}, after, true},
+		{"start/end: at end is included", ResourceFilter{Start: bound, End: end}, end, true},
+		{"start/end: after end", ResourceFilter{Start: bound, End: end}, end.Add(time.Second), false},
+		{"start equals end", ResourceFilter{Start: bound, End: bound}, bound, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inTimeRange(tt.t, tt.filter); got != tt.want {
+				t.Errorf("inTimeRange(%s) = %v, want %v", tt.t.Format(time.RFC3339), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListScope(t *testing.T) {
+	some := namespaceList{"default", "kube-system"}
+
+	tests := []struct {
+		name              string
+		namespaces        namespaceList
+		includeCluster    bool
+		includeNamespaced bool
+		wantScope         []string
+		wantNamespaced    bool
+		wantOK            bool
+	}{
+		{"all namespaces, both", nil, true, true, nil, true, true},
+		{"all namespaces, cluster only", nil, true, false, nil, false, true},
+		{"all namespaces, namespaced only", nil, false, true, nil, true, true},
+		{"all namespaces, neither", nil, false, false, nil, false, false},
+		{"namespaces, both", some, true, true, some, true, true},
+		{"namespaces, cluster only", some, true, false, some, false, true},
+		{"namespaces, namespaced only", some, false, true, some, true, true},
+		{"namespaces, neither", some, false, false, some, false, false},
+		{"star is all namespaces", namespaceList{"*"}, false, true, nil, true, true},
+		{"empty namespace turns namespaced off", namespaceList{""}, true, true, nil, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scope, namespaced, ok := listScope(tt.namespaces, tt.includeCluster, tt.includeNamespaced)
+			if !reflect.DeepEqual(scope, tt.wantScope) || namespaced != tt.wantNamespaced || ok != tt.wantOK {
+				t.Errorf("listScope(%q, %v, %v) = %q, %v, %v, want %q, %v, %v",
+					tt.namespaces, tt.includeCluster, tt.includeNamespaced,
+					scope, namespaced, ok, tt.wantScope, tt.wantNamespaced, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestExitCodeFor(t *testing.T) {
+	pods := schema.GroupResource{Resource: "pods"}
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"network", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, exitConnection},
+		{"unauthorized", apierrors.NewUnauthorized("bad token"), exitConnection},
+		{"forbidden", apierrors.NewForbidden(pods, "", errors.New("no rights")), exitUsage},
+		{"other", errors.New("boom"), exitUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCodeFor(tt.err, exitUsage); got != tt.want {
+				t.Errorf("exitCodeFor(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountSkipped(t *testing.T) {
+	apiResources := []*metav1.APIResourceList{
+		{GroupVersion: "v1", APIResources: []metav1.APIResource{{Name: "pods"}, {Name: "pods/status"}, {Name: "configmaps"}}},
+		{GroupVersion: "apps/v1", APIResources: []metav1.APIResource{{Name: "deployments"}}},
+		{GroupVersion: "apps/v1beta2", APIResources: []metav1.APIResource{{Name: "deployments"}}},
+	}
+	job := func(group, version, resource string) listJob {
+		return listJob{gvr: schema.GroupVersionResource{Group: group, Version: version, Resource: resource}}
+	}
+
+	tests := []struct {
+		name    string
+		planned []listJob
+		want    int
+	}{
+		{"everything", []listJob{job("", "v1", "pods"), job("", "v1", "configmaps"), job("apps", "v1", "deployments"), job("apps", "v1beta2", "deployments")}, 0},
+		{"nothing", nil, 4},
+		{"some", []listJob{job("", "v1", "pods")}, 3},
+		{"subresources", []listJob{job("", "v1", "pods"), job("", "v1", "pods/status"), job("", "v1", "configmaps")}, 2},
+		{"all versions of one group", []listJob{job("apps", "v1", "deployments"), job("apps", "v1beta2", "deployments")}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countSkipped(apiResources, tt.planned); got != tt.want {
+				t.Errorf("countSkipped = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamespaceListSet(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   namespaceList
+	}{
+		{"single", []string{"default"}, namespaceList{"default"}},
+		{"comma-separated", []string{"a,b,c"}, namespaceList{"a", "b", "c"}},
+		{"repeated", []string{"a", "b,c"}, namespaceList{"a", "b", "c"}},
+		{"spaces trimmed", []string{" a , b "}, namespaceList{"a", "b"}},
+		{"empty entries dropped", []string{"a,,b,"}, namespaceList{"a", "b"}},
+		{"empty is cluster-only", []string{""}, namespaceList{""}},
+		{"star", []string{"*"}, namespaceList{"*"}},
+		{"star mixed with names", []string{"default,*", "kube-*"}, namespaceList{"default", "*", "kube-*"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got namespaceList
+			for _, value := range tt.values {
+				if err := got.Set(value); err != nil {
+					t.Fatalf("Set(%q): %v", value, err)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Set(%q) = %q, want %q", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamespaceFlag(t *testing.T) {
+	var o options
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	o.addFlags(fs)
+	if err := fs.Parse([]string{"-n", "a,b", "--namespace=c", "-n", "*"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := (namespaceList{"a", "b", "c", "*"}); !reflect.DeepEqual(o.namespaces, want) {
+		t.Errorf("--namespace = %q, want %q", o.namespaces, want)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"30m", 30 * time.Minute, false},
+		{"24h", 24 * time.Hour, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"1d12h", 36 * time.Hour, false},
+		{"1d30m", 24*time.Hour + 30*time.Minute, false},
+		{"1.5d", 0, true},
+		{"d", 0, true},
+		{"7x", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseDuration(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDuration(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseDuration(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTimeFlag(t *testing.T) {
+	now := time.Date(2025, 8, 10, 9, 39, 9, 0, time.UTC)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		loc     *time.Location
+		want    time.Time
+		wantErr bool
+	}{
+		{"RFC3339", "2025-01-02T03:04:05Z", nil, time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), false},
+		{"RFC3339 with offset", "2025-01-02T03:04:05+02:00", nil, time.Date(2025, 1, 2, 1, 4, 5, 0, time.UTC), false},
+		{"hours", "24h", nil, now.Add(-24 * time.Hour), false},
+		{"days", "7d", nil, now.Add(-7 * 24 * time.Hour), false},
+		{"negative days", "-7d", nil, now.Add(-7 * 24 * time.Hour), false},
+		{"days and hours", "1d12h", nil, now.Add(-36 * time.Hour), false},
+		{"fractional days", "1.5d", nil, time.Time{}, true},
+		{"garbage", "yesterday", nil, time.Time{}, true},
+		{"local time without timezone", "2025-01-02 03:04", nil, time.Time{}, true},
+		{"local time", "2025-01-02 03:04", berlin, time.Date(2025, 1, 2, 2, 4, 0, 0, time.UTC), false},
+		{"local date", "2025-07-01", berlin, time.Date(2025, 6, 30, 22, 0, 0, 0, time.UTC), false},
+		{"garbage with timezone", "yesterday", berlin, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTimeFlag(tt.value, now, tt.loc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTimeFlag(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseTimeFlag(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAnnotationRequirement(t *testing.T) {
+	tests := []struct {
+		term    string
+		want    annotationRequirement
+		wantErr bool
+	}{
+		{"example.com/owner", annotationRequirement{key: "example.com/owner", op: "exists"}, false},
+		{"!example.com/owner", annotationRequirement{key: "example.com/owner", op: "!exists"}, false},
+		{"team=web", annotationRequirement{key: "team", value: "web", op: "="}, false},
+		{"team!=web", annotationRequirement{key: "team", value: "web", op: "!="}, false},
+		{"team=", annotationRequirement{key: "team", op: "="}, false},
+		{"note=a=b", annotationRequirement{key: "note", value: "a=b", op: "="}, false},
+		{" team =web", annotationRequirement{key: "team", value: "web", op: "="}, false},
+		{"", annotationRequirement{}, true},
+		{"!", annotationRequirement{}, true},
+		{"=web", annotationRequirement{}, true},
+		{"!=web", annotationRequirement{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.term, func(t *testing.T) {
+			got, err := parseAnnotationRequirement(tt.term)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAnnotationRequirement(%q) error = %v, want error %v", tt.term, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseAnnotationRequirement(%q) = %+v, want %+v", tt.term, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesAnnotations(t *testing.T) {
+	annotations := map[string]string{"team": "web", "example.com/owner": "alice"}
+	tests := []struct {
+		terms []string
+		want  bool
+	}{
+		{nil, true},
+		{[]string{"team"}, true},
+		{[]string{"missing"}, false},
+		{[]string{"!missing"}, true},
+		{[]string{"!team"}, false},
+		{[]string{"team=web"}, true},
+		{[]string{"team=db"}, false},
+		{[]string{"team!=db"}, true},
+		{[]string{"team!=web"}, false},
+		{[]string{"missing!=web"}, true},
+		{[]string{"missing=web"}, false},
+		{[]string{"team=web", "example.com/owner=alice"}, true},
+		{[]string{"team=web", "example.com/owner=bob"}, false},
+	}
+	for _, tt := range tests {
+		var reqs []annotationRequirement
+		for _, term := range tt.terms {
+			req, err := parseAnnotationRequirement(term)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reqs = append(reqs, req)
+		}
+		if got := matchesAnnotations(reqs, annotations); got != tt.want {
+			t.Errorf("matchesAnnotations(%q) = %v, want %v", tt.terms, got, tt.want)
+		}
+	}
+}
+
+func TestResourceExclusion(t *testing.T) {
+	tests := []struct {
+		entry   string
+		want    string
+		wantErr bool
+	}{
+		{"apps/controllerrevisions", "apps/controllerrevisions", false},
+		{"apps/v1/controllerrevisions", "apps/v1/controllerrevisions", false},
+		{"core/events", "/events", false},
+		{"core/v1/events", "/v1/events", false},
+		{"apps", "apps", false},
+		{"apps/v1/deployments/scale", "", true},
+		{"apps//deployments", "", true},
+		{"/events", "", true},
+		{"apps/", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.entry, func(t *testing.T) {
+			got, err := resourceExclusion(tt.entry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resourceExclusion(%q) error = %v, want error %v", tt.entry, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resourceExclusion(%q) = %q, want %q", tt.entry, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsResourceExcluded(t *testing.T) {
+	gvr := func(group, version, resource string) schema.GroupVersionResource {
+		return schema.GroupVersionResource{Group: group, Version: version, Resource: resource}
+	}
+	tests := []struct {
+		name    string
+		entries []string
+		gvr     schema.GroupVersionResource
+		want    bool
+	}{
+		{"any version", []string{"apps/controllerrevisions"}, gvr("apps", "v1", "controllerrevisions"), true},
+		{"any version, another one", []string{"apps/controllerrevisions"}, gvr("apps", "v1beta2", "controllerrevisions"), true},
+		{"exact version", []string{"apps/v1/controllerrevisions"}, gvr("apps", "v1", "controllerrevisions"), true},
+		{"exact version, another one", []string{"apps/v1/controllerrevisions"}, gvr("apps", "v1beta2", "controllerrevisions"), false},
+		{"another resource of the group", []string{"apps/controllerrevisions"}, gvr("apps", "v1", "deployments"), false},
+		{"same resource of another group", []string{"apps/controllerrevisions"}, gvr("example.com", "v1", "controllerrevisions"), false},
+		{"core group", []string{"core/events"}, gvr("", "v1", "events"), true},
+		{"core group, exact version", []string{"core/v1/events"}, gvr("", "v1", "events"), true},
+		{"core entry doesn't match a group", []string{"core/events"}, gvr("events.k8s.io", "v1", "events"), false},
+		{"subresource with its parent", []string{"apps/deployments"}, gvr("apps", "v1", "deployments/scale"), true},
+		{"bare group isn't a resource", []string{"apps"}, gvr("apps", "v1", "deployments"), false},
+		{"nothing excluded", nil, gvr("apps", "v1", "deployments"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			excluded := make(map[string]bool)
+			for _, entry := range tt.entries {
+				key, err := resourceExclusion(entry)
+				if err != nil {
+					t.Fatal(err)
+				}
+				excluded[key] = true
+			}
+			if got := isResourceExcluded(excluded, tt.gvr); got != tt.want {
+				t.Errorf("isResourceExcluded(%q, %s) = %v, want %v", tt.entries, tt.gvr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetExcludedGroups(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "excluded-groups")
+	content := "# comment\nmetrics.k8s.io\napps/v1/controllerrevisions\ncore/events\n\nbad//entry\n"
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer log.SetOutput(os.Stderr)
+	log.SetOutput(io.Discard)
+
+	got := getExcludedGroups(file)
+	want := map[string]bool{"metrics.k8s.io": true, "apps/v1/controllerrevisions": true, "/events": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getExcludedGroups = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// objectStore uploads files to an object storage location.
+type objectStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+}
+
+// newObjectStore returns the store of an --output-url.
+func newObjectStore(rawURL string) (objectStore, error) {
+	bucket, prefix, err := parseS3URL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %v", err)
+	}
+	return &s3Store{client: s3.NewFromConfig(cfg), bucket: bucket, prefix: prefix}, nil
+}
+
+// parseS3URL splits s3://bucket/prefix into the bucket and the key prefix.
+func parseS3URL(rawURL string) (bucket, prefix string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Scheme != "s3" {
+		return "", "", fmt.Errorf("%q: only s3:// URLs are supported", rawURL)
+	}
+	if u.Host == "" {
+		return "", "", fmt.Errorf("%q has no bucket", rawURL)
+	}
+	return u.Host, strings.Trim(u.Path, "/"), nil
+}
+
+// s3Store puts objects below prefix in an S3 bucket.
+type s3Store struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, data []byte) error {
+	if s.prefix != "" {
+		key = s.prefix + "/" + key
+	}
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/yaml"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload s3://%s/%s: %v", s.bucket, key, err)
+	}
+	return nil
+}
+
+// storePrinter uploads every object as a YAML file, laid out like dirPrinter.
+// The uploads are canceled with ctx, the context of the run.
+type storePrinter struct {
+	ctx     context.Context
+	store   objectStore
+	layout  *template.Template
+	paths   uniquePaths
+	timeout time.Duration
+}
+
+func (p *storePrinter) Print(rec resourceRecord) error {
+	data, err := rec.Item.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	name, err := objectPath(rec, p.layout)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	writeYAML(data, &buf)
+
+	ctx, cancel := requestContext(p.ctx, p.timeout)
+	defer cancel()
+	if err := p.store.Put(ctx, p.paths.claim(name), buf.Bytes()); err != nil {
+		return err
+	}
+	summary.addBytes(buf.Len())
+	return nil
+}
+
+func (p *storePrinter) Finish() error { return nil }
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// blockingStore is an objectStore whose uploads hang until canceled.
+type blockingStore struct{}
+
+func (blockingStore) Put(ctx context.Context, key string, data []byte) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestStorePrinterCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &storePrinter{ctx: ctx, store: blockingStore{}, timeout: time.Hour}
+	done := make(chan error, 1)
+	go func() { done <- p.Print(testRecord(podsGVR, "Pod", "default", "web-0")) }()
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Print = %v, want it canceled", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the upload wasn't canceled with the run")
+	}
+}
@@ -0,0 +1,1251 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	jsonserializer "k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// Supported values of --output-format. An empty format means CSV.
+const (
+	formatCSV        = "csv"
+	formatJSON       = "json"
+	formatYAML       = "yaml"
+	formatTable      = "table"
+	formatWide       = "wide"
+	formatName       = "name"
+	formatYAMLStream = "yaml-stream"
+	formatJSONL      = "jsonl"
+	formatGoTemplate = "go-template"
+	formatJSONPath   = "jsonpath"
+)
+
+var outputFormats = []string{formatCSV, formatJSON, formatJSONL, formatYAML, formatYAMLStream, formatTable, formatWide, formatName, formatGoTemplate, formatJSONPath}
+
+// watchFormats are the output formats written object by object, which
+// --watch can stream. The empty default is CSV.
+var watchFormats = []string{"", formatCSV, formatJSONL, formatYAMLStream, formatName, formatGoTemplate, formatJSONPath}
+
+// Supported values of --sort-by.
+const (
+	sortByCreationTimestamp = "creationtimestamp"
+	sortByName              = "name"
+	sortByNamespace         = "namespace"
+	sortByKind              = "kind"
+)
+
+var sortKeys = []string{sortByCreationTimestamp, sortByName, sortByNamespace, sortByKind}
+
+// resourceRecord is a collected object together with the resource it was
+// listed as.
+type resourceRecord struct {
+	Item *unstructured.Unstructured
+	GVR  schema.GroupVersionResource
+	// Context is the kubeconfig context of the object when collecting from
+	// several, empty otherwise.
+	Context string
+	// Location is the --timezone to show timestamps in, nil for UTC.
+	Location *time.Location
+}
+
+// resourcePrinter writes collected objects in one output format. Print is
+// called concurrently by the listing workers, so implementations must be safe
+// for concurrent use. Finish is called once after everything was printed.
+type resourcePrinter interface {
+	Print(rec resourceRecord) error
+	Finish() error
+}
+
+// newPrinter returns the printer selected by the filter's output flags.
+// Printers that make requests of their own, such as the uploads of
+// --output-url, are canceled with ctx.
+func newPrinter(ctx context.Context, filter ResourceFilter, w io.Writer) (resourcePrinter, error) {
+	if filter.DryRun {
+		return nopPrinter{}, nil
+	}
+	if !filter.AllowDuplicates {
+		unfiltered := filter
+		unfiltered.AllowDuplicates = true
+		inner, err := newPrinter(ctx, unfiltered, w)
+		if err != nil {
+			return nil, err
+		}
+		return &dedupePrinter{next: inner, pending: make(map[dedupeScope]int), seen: make(map[dedupeScope]map[string]bool)}, nil
+	}
+	if filter.OwnedBy != nil {
+		unfiltered := filter
+		unfiltered.OwnedBy = nil
+		inner, err := newPrinter(ctx, unfiltered, w)
+		if err != nil {
+			return nil, err
+		}
+		return &ownedByPrinter{next: inner, owner: *filter.OwnedBy}, nil
+	}
+	if filter.SortBy != "" {
+		unsorted := filter
+		unsorted.SortBy = ""
+		inner, err := newPrinter(ctx, unsorted, w)
+		if err != nil {
+			return nil, err
+		}
+		return &sortingPrinter{next: inner, key: filter.SortBy}, nil
+	}
+	p, err := newOutputPrinter(ctx, filter, w)
+	if err != nil {
+		return nil, err
+	}
+	return &statsPrinter{next: p}, nil
+}
+
+// newOutputPrinter returns the printer that writes the objects passed on by
+// the filtering and sorting printers of newPrinter.
+func newOutputPrinter(ctx context.Context, filter ResourceFilter, w io.Writer) (resourcePrinter, error) {
+	if filter.CountOnly {
+		return &countPrinter{w: w, counts: make(map[schema.GroupVersionResource]int)}, nil
+	}
+	if filter.ReportDeprecated {
+		return &deprecationPrinter{w: w, printHeader: !filter.NoHeaders}, nil
+	}
+	if filter.OutputDir != "" {
+		return newDirPrinter(filter.OutputDir, filter.PathTemplate, filter.Resume, filter.Overwrite, filter.Kustomization, filter.Compress)
+	}
+	if filter.Archive != "" {
+		return newArchivePrinter(filter.Archive, filter.PathTemplate, w)
+	}
+	if filter.OutputURL != "" {
+		store, err := newObjectStore(filter.OutputURL)
+		if err != nil {
+			return nil, err
+		}
+		return &storePrinter{ctx: ctx, store: store, layout: filter.PathTemplate, timeout: filter.RequestTimeout}, nil
+	}
+	switch filter.OutputFormat {
+	case "", formatCSV:
+		return newCSVPrinter(w, filter.Columns, filter.Delimiter, !filter.NoHeaders)
+	case formatJSON, formatYAML:
+		return &listPrinter{w: w, yaml: filter.OutputFormat == formatYAML}, nil
+	case formatJSONL:
+		return &jsonLinesPrinter{w: w}, nil
+	case formatYAMLStream:
+		return &yamlStreamPrinter{w: w}, nil
+	case formatTable, formatWide:
+		return newTablePrinter(w, filter.ShowLabels, filter.OutputFormat == formatWide, !filter.NoHeaders)
+	case formatName:
+		return &namePrinter{w: w}, nil
+	case formatGoTemplate:
+		return &templatePrinter{w: w, tmpl: filter.Template}, nil
+	case formatJSONPath:
+		return &jsonPathPrinter{w: w, jp: filter.JSONPath}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", filter.OutputFormat)
+}
+
+// csvColumns are the values --columns can select, by name.
+var csvColumns = map[string]func(rec resourceRecord) (string, error){
+	"context":    func(rec resourceRecord) (string, error) { return rec.Context, nil },
+	"kind":       func(rec resourceRecord) (string, error) { return rec.Item.GetKind(), nil },
+	"plural":     func(rec resourceRecord) (string, error) { return rec.GVR.Resource, nil },
+	"apiversion": func(rec resourceRecord) (string, error) { return rec.Item.GetAPIVersion(), nil },
+	"namespace":  func(rec resourceRecord) (string, error) { return rec.Item.GetNamespace(), nil },
+	"name":       func(rec resourceRecord) (string, error) { return rec.Item.GetName(), nil },
+	"creationtimestamp": func(rec resourceRecord) (string, error) {
+		return formatTimestamp(rec.Item.GetCreationTimestamp().Time, rec.Location), nil
+	},
+	"age":             func(rec resourceRecord) (string, error) { return objectAge(rec.Item), nil },
+	"uid":             func(rec resourceRecord) (string, error) { return string(rec.Item.GetUID()), nil },
+	"resourceversion": func(rec resourceRecord) (string, error) { return rec.Item.GetResourceVersion(), nil },
+	"labels":          func(rec resourceRecord) (string, error) { return labels.Set(rec.Item.GetLabels()).String(), nil },
+	"ownerkind":       ownerKinds,
+	"data": func(rec resourceRecord) (string, error) {
+		data, err := rec.Item.MarshalJSON()
+		return string(data), err
+	},
+}
+
+// defaultCSVColumns are written when --columns isn't given; --resource-data
+// appends data.
+var defaultCSVColumns = []string{"kind", "plural", "apiversion", "namespace", "name", "creationtimestamp"}
+
+func csvColumnNames() []string {
+	names := make([]string, 0, len(csvColumns))
+	for name := range csvColumns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ownerKinds returns the distinct kinds of an object's owner references.
+func ownerKinds(rec resourceRecord) (string, error) {
+	var kinds []string
+	for _, ref := range rec.Item.GetOwnerReferences() {
+		if !contains(kinds, ref.Kind) {
+			kinds = append(kinds, ref.Kind)
+		}
+	}
+	return strings.Join(kinds, ","), nil
+}
+
+// csvPrinter writes one CSV row per object, flushing each row so output
+// streams while the collection is still running.
+type csvPrinter struct {
+	mu      sync.Mutex
+	w       *csv.Writer
+	columns []string
+}
+
+func newCSVPrinter(w io.Writer, columns []string, delimiter rune, printHeader bool) (*csvPrinter, error) {
+	p := &csvPrinter{w: csv.NewWriter(w), columns: columns}
+	if delimiter != 0 {
+		p.w.Comma = delimiter
+	}
+	if !printHeader {
+		return p, nil
+	}
+	return p, p.write(columns)
+}
+
+func (p *csvPrinter) Print(rec resourceRecord) error {
+	row := make([]string, len(p.columns))
+	for i, column := range p.columns {
+		value, err := csvColumns[column](rec)
+		if err != nil {
+			return err
+		}
+		row[i] = value
+	}
+	return p.write(row)
+}
+
+func (p *csvPrinter) write(row []string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.w.Write(row); err != nil {
+		return err
+	}
+	p.w.Flush()
+	return p.w.Error()
+}
+
+func (p *csvPrinter) Finish() error { return nil }
+
+// dirPrinter saves every object as a YAML file under dir, at the path given
+// by layout or the default layout if it is nil, and lists them in the
+// index.csv manifest at the top of dir, and with kustomization in a
+// kustomization.yaml too. With compress every file is gzipped, with a .gz
+// suffix. When resuming, objects already saved by the previous run are
+// skipped.
+type dirPrinter struct {
+	dir           string
+	layout        *template.Template
+	paths         uniquePaths
+	resume        bool
+	kustomization bool
+	compress      bool
+
+	mu        sync.Mutex
+	indexFile *os.File
+	index     *csv.Writer
+	saved     map[indexKey]bool
+	skipped   int
+}
+
+// compressedSuffix is added to the file names of --compress.
+const compressedSuffix = ".gz"
+
+// indexFileName is the manifest dirPrinter writes next to the objects.
+const indexFileName = "index.csv"
+
+// snapshotFileName records in an --output-dir how the dump was taken, see
+// runSummary.writeSnapshot.
+const snapshotFileName = "snapshot.json"
+
+// indexHeader names the manifest columns. Manifests written before the
+// context column was added are still read.
+var indexHeader = []string{"kind", "apiversion", "namespace", "name", "path", "context"}
+
+// indexKey identifies an object of the manifest across the versions of its
+// resource.
+type indexKey struct {
+	context   string
+	group     string
+	kind      string
+	namespace string
+	name      string
+}
+
+func newIndexKey(row []string) indexKey {
+	gv, _ := schema.ParseGroupVersion(row[1])
+	return indexKey{row[5], gv.Group, row[0], row[2], row[3]}
+}
+
+// newDirPrinter prepares dir for a dump. A dir already holding one, i.e. an
+// index.csv, is only written to with resume, which keeps the previous
+// objects and adds the missing ones, or overwrite, which starts over.
+func newDirPrinter(dir string, layout *template.Template, resume, overwrite, kustomization, compress bool) (*dirPrinter, error) {
+	indexPath := filepath.Join(dir, indexFileName)
+	// Writing into a directory that isn't empty would mix two snapshots.
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 && !resume && !overwrite {
+		if _, err := os.Stat(indexPath); err == nil {
+			return nil, fmt.Errorf("%s already holds a dump (%s): use --resume to complete it or --overwrite to replace it", dir, indexFileName)
+		}
+		return nil, fmt.Errorf("%s is not empty: choose another directory, or use --overwrite to write into it anyway (its other files are kept)", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var previous [][]string
+	if _, err := os.Stat(indexPath); err == nil && resume {
+		if previous, err = readIndex(indexPath); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", indexPath, err)
+		}
+	}
+
+	f, err := os.Create(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	p := &dirPrinter{dir: dir, layout: layout, resume: resume, kustomization: kustomization, compress: compress, indexFile: f, index: csv.NewWriter(f), saved: make(map[indexKey]bool)}
+	p.paths.claim(indexFileName)
+	p.paths.claim(snapshotFileName)
+	p.paths.claim(kustomizationFileName)
+	if err := p.addToIndex(indexHeader); err != nil {
+		return nil, err
+	}
+	// The previous rows are carried over, so the manifest still lists every
+	// object in dir.
+	for _, row := range previous {
+		p.saved[newIndexKey(row)] = true
+		p.paths.claim(row[4])
+		if err := p.addToIndex(row); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// readIndex returns the rows of a manifest written by dirPrinter, without
+// its header.
+func readIndex(name string) ([][]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	// The reader already checked every row has as many fields as the header.
+	withoutContext := indexHeader[:len(indexHeader)-1]
+	if len(rows) == 0 || !(slices.Equal(rows[0], indexHeader) || slices.Equal(rows[0], withoutContext)) {
+		return nil, errors.New("unexpected header")
+	}
+	rows = rows[1:]
+	for i := range rows {
+		if len(rows[i]) == len(withoutContext) {
+			rows[i] = append(rows[i], "")
+		}
+	}
+	return rows, nil
+}
+
+func (p *dirPrinter) Print(rec resourceRecord) error {
+	item := rec.Item
+	data, err := item.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	rel, err := objectPath(rec, p.layout)
+	if err != nil {
+		return err
+	}
+	if p.compress {
+		rel += compressedSuffix
+	}
+	row := []string{item.GetKind(), item.GetAPIVersion(), item.GetNamespace(), item.GetName(), rel, rec.Context}
+	if p.resume {
+		done, err := p.resumed(row)
+		if done || err != nil {
+			return err
+		}
+	}
+	rel = p.paths.claim(rel)
+	row[4] = rel
+	file := filepath.Join(p.dir, filepath.FromSlash(rel))
+	if err := p.writeFile(file, data); err != nil {
+		return err
+	}
+	return p.addToIndex(row)
+}
+
+// writeFile saves an object to file. It is written to a temporary file
+// renamed into place, so a run that is killed leaves no truncated file that
+// --resume would take for saved.
+func (p *dirPrinter) writeFile(file string, data []byte) error {
+	_ = os.MkdirAll(filepath.Dir(file), 0755)
+	f, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if p.compress {
+		gz := gzip.NewWriter(countingWriter{f})
+		writeYAML(data, gz)
+		err = gz.Close()
+	} else {
+		writeYAML(data, countingWriter{f})
+	}
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write file: %v", err)
+	}
+	return os.Rename(f.Name(), file)
+}
+
+// resumed reports whether the object of row was saved by the previous run,
+// either listed in its manifest or, if the run stopped before indexing it,
+// found at its path. The latter is added to the manifest.
+func (p *dirPrinter) resumed(row []string) (bool, error) {
+	key := newIndexKey(row)
+	p.mu.Lock()
+	saved := p.saved[key]
+	if saved {
+		p.skipped++
+	}
+	p.mu.Unlock()
+	if saved {
+		return true, nil
+	}
+	if _, err := os.Stat(filepath.Join(p.dir, filepath.FromSlash(row[4]))); err != nil {
+		return false, nil
+	}
+	p.paths.claim(row[4])
+	p.mu.Lock()
+	p.saved[key] = true
+	p.skipped++
+	p.mu.Unlock()
+	return true, p.addToIndex(row)
+}
+
+// addToIndex appends a row to the manifest, flushing it so the index is
+// usable even if the run is interrupted.
+func (p *dirPrinter) addToIndex(row []string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.index.Write(row); err != nil {
+		return err
+	}
+	p.index.Flush()
+	return p.index.Error()
+}
+
+func (p *dirPrinter) Finish() error {
+	if p.resume {
+		vlogf(logInfo, "Resumed %s: skipped %d objects saved by the previous run", p.dir, p.skipped)
+	}
+	if err := p.indexFile.Close(); err != nil {
+		return err
+	}
+	if p.kustomization {
+		return writeKustomization(p.dir)
+	}
+	return nil
+}
+
+// pathFields are the values available to --path-template. Every field is
+// sanitized to a single path segment; Namespace is _cluster for
+// cluster-scoped objects and Group is empty for core resources.
+type pathFields struct {
+	Namespace string
+	Group     string
+	Version   string
+	Resource  string
+	Kind      string
+	Name      string
+}
+
+// parsePathTemplate parses a --path-template and renders it once with
+// placeholder values, so unknown fields and paths escaping the output
+// directory fail before anything is listed.
+func parsePathTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("path").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	fields := pathFields{Namespace: "ns", Group: "group", Version: "v1", Resource: "resources", Kind: "Kind", Name: "name"}
+	if err := tmpl.Execute(&buf, fields); err != nil {
+		return nil, err
+	}
+	if _, err := relativePath(buf.String()); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// clusterDir is the namespace directory of cluster-scoped objects in the
+// default layout.
+const clusterDir = "_cluster"
+
+// objectPath returns the slash-separated path of an object's YAML file
+// relative to the output directory. Without a layout template it is
+// namespace/resource.group/name.yaml, with cluster-scoped objects under
+// _cluster and core resources left unqualified. Objects tagged with a context
+// are placed in a directory named after it.
+func objectPath(rec resourceRecord, layout *template.Template) (string, error) {
+	if rec.Context != "" {
+		// Every context gets its own top-level directory.
+		rel, err := objectPath(resourceRecord{Item: rec.Item, GVR: rec.GVR}, layout)
+		if err != nil {
+			return "", err
+		}
+		return path.Join(sanitizeSegment(rec.Context), rel), nil
+	}
+	item := rec.Item
+	if layout == nil {
+		namespace := item.GetNamespace()
+		if namespace == "" {
+			namespace = clusterDir
+		}
+		resource := rec.GVR.Resource
+		if rec.GVR.Group != "" {
+			resource += "." + rec.GVR.Group
+		}
+		return path.Join(sanitizeSegment(namespace), sanitizeSegment(resource), sanitizeSegment(item.GetName())+".yaml"), nil
+	}
+
+	var buf bytes.Buffer
+	namespace := item.GetNamespace()
+	if namespace == "" {
+		namespace = clusterDir
+	}
+	err := layout.Execute(&buf, pathFields{
+		Namespace: sanitizeSegment(namespace),
+		Group:     sanitizeSegment(rec.GVR.Group),
+		Version:   sanitizeSegment(rec.GVR.Version),
+		Resource:  sanitizeSegment(rec.GVR.Resource),
+		Kind:      sanitizeSegment(item.GetKind()),
+		Name:      sanitizeSegment(item.GetName()),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render --path-template: %v", err)
+	}
+	return relativePath(buf.String())
+}
+
+// relativePath cleans a rendered --path-template and rejects results that
+// would point outside the output directory. Empty segments, such as the
+// .Group of a core resource, are dropped rather than producing "//" or a
+// leading "/".
+func relativePath(rendered string) (string, error) {
+	var segments []string
+	for _, segment := range strings.Split(strings.ReplaceAll(rendered, "\\", "/"), "/") {
+		switch segment {
+		case "", ".":
+		case "..":
+			return "", fmt.Errorf("path %q is outside the output directory", rendered)
+		default:
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) == 0 {
+		return "", fmt.Errorf("path %q is empty", rendered)
+	}
+	return path.Join(segments...), nil
+}
+
+// sanitizeSegment makes s safe to use as a single path segment: separators,
+// control characters and characters that Windows or macOS filesystems reject
+// (such as the colons in some CRD object names) are replaced, and "." or ".."
+// can't climb out of the output directory.
+func sanitizeSegment(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+	if s == "." || s == ".." {
+		return strings.Repeat("_", len(s))
+	}
+	return s
+}
+
+// uniquePaths hands out output paths, adding a -2, -3, ... suffix before the
+// extension when a path was already used, so objects whose names sanitize to
+// the same file don't overwrite each other.
+type uniquePaths struct {
+	mu   sync.Mutex
+	used map[string]bool
+}
+
+func (u *uniquePaths) claim(name string) string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.used == nil {
+		u.used = make(map[string]bool)
+	}
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	unique := name
+	for n := 2; u.used[unique]; n++ {
+		unique = fmt.Sprintf("%s-%d%s", base, n, ext)
+	}
+	u.used[unique] = true
+	return unique
+}
+
+// archivePrinter streams the YAML files of dirPrinter into a gzip-compressed
+// tar archive instead of loose files, or into a plain tar on stdout.
+type archivePrinter struct {
+	mu     sync.Mutex
+	file   *os.File
+	gz     *gzip.Writer
+	tw     *tar.Writer
+	layout *template.Template
+	paths  uniquePaths
+}
+
+// newArchivePrinter creates the archive name, or writes an uncompressed tar
+// to w if name is "-".
+func newArchivePrinter(name string, layout *template.Template, w io.Writer) (*archivePrinter, error) {
+	if name == "-" {
+		return &archivePrinter{tw: tar.NewWriter(w), layout: layout}, nil
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(countingWriter{f})
+	return &archivePrinter{file: f, gz: gz, tw: tar.NewWriter(gz), layout: layout}, nil
+}
+
+func (p *archivePrinter) Print(rec resourceRecord) error {
+	data, err := rec.Item.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	name, err := objectPath(rec, p.layout)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	writeYAML(data, &buf)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	header := &tar.Header{
+		Name:     p.paths.claim(name),
+		Mode:     0644,
+		Size:     int64(buf.Len()),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}
+	if err := p.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = p.tw.Write(buf.Bytes())
+	return err
+}
+
+func (p *archivePrinter) Finish() error {
+	if err := p.tw.Close(); err != nil {
+		return err
+	}
+	if p.file == nil {
+		return nil
+	}
+	if err := p.gz.Close(); err != nil {
+		return err
+	}
+	return p.file.Close()
+}
+
+// listPrinter collects every object and writes them as a single v1 List in
+// JSON or YAML once the collection is done.
+type listPrinter struct {
+	mu    sync.Mutex
+	w     io.Writer
+	yaml  bool
+	items []interface{}
+}
+
+func (p *listPrinter) Print(rec resourceRecord) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.items = append(p.items, rec.Item.Object)
+	return nil
+}
+
+func (p *listPrinter) Finish() error {
+	list := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"metadata":   map[string]interface{}{},
+		"items":      p.items,
+	}
+	if p.items == nil {
+		list["items"] = []interface{}{}
+	}
+	data, err := json.MarshalIndent(list, "", "    ")
+	if err != nil {
+		return err
+	}
+	if p.yaml {
+		writeYAML(data, p.w)
+		return nil
+	}
+	_, err = fmt.Fprintf(p.w, "%s\n", data)
+	return err
+}
+
+// jsonLinesPrinter writes every object as compact JSON on its own line.
+type jsonLinesPrinter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (p *jsonLinesPrinter) Print(rec resourceRecord) error {
+	data, err := rec.Item.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	data = append(bytes.TrimRight(data, "\n"), '\n')
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.w.Write(data)
+	return err
+}
+
+func (p *jsonLinesPrinter) Finish() error { return nil }
+
+// yamlStreamPrinter writes every object as its own "---" separated YAML
+// document, producing a stream that can be fed to kubectl apply -f.
+type yamlStreamPrinter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (p *yamlStreamPrinter) Print(rec resourceRecord) error {
+	data, err := rec.Item.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	writeYAML(data, &buf)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.w.Write(buf.Bytes())
+	return err
+}
+
+func (p *yamlStreamPrinter) Finish() error { return nil }
+
+// tablePrinter writes a padded, human-readable column view. The wide view
+// adds kubectl-like columns: the age, the ready count of pods and workloads
+// and the node of pods.
+type tablePrinter struct {
+	mu         sync.Mutex
+	w          *tabwriter.Writer
+	showLabels bool
+	wide       bool
+}
+
+func newTablePrinter(w io.Writer, showLabels, wide, printHeader bool) (*tablePrinter, error) {
+	p := &tablePrinter{w: tabwriter.NewWriter(w, 10, 4, 3, ' ', 0), showLabels: showLabels, wide: wide}
+	if !printHeader {
+		return p, nil
+	}
+	header := "NAMESPACE\tKIND\tAPIVERSION\tNAME\tCREATED"
+	if wide {
+		header += "\tAGE\tREADY\tNODE"
+	}
+	if showLabels {
+		header += "\tLABELS"
+	}
+	_, err := fmt.Fprintln(p.w, header)
+	return p, err
+}
+
+func (p *tablePrinter) Print(rec resourceRecord) error {
+	item := rec.Item
+	row := fmt.Sprintf("%s\t%s\t%s\t%s\t%s", item.GetNamespace(), item.GetKind(), item.GetAPIVersion(), item.GetName(), formatTimestamp(item.GetCreationTimestamp().Time, rec.Location))
+	if p.wide {
+		node := "<none>"
+		if rec.GVR.Group == "" && rec.GVR.Resource == "pods" {
+			if name, _, _ := unstructured.NestedString(item.Object, "spec", "nodeName"); name != "" {
+				node = name
+			}
+		}
+		row += "\t" + objectAge(item) + "\t" + readyStatus(rec) + "\t" + node
+	}
+	if p.showLabels {
+		labelString := labels.Set(item.GetLabels()).String()
+		if labelString == "" {
+			labelString = "<none>"
+		}
+		row += "\t" + labelString
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := fmt.Fprintln(p.w, row)
+	return err
+}
+
+// formatTimestamp formats t as RFC3339 in loc, UTC if it is nil.
+func formatTimestamp(t time.Time, loc *time.Location) string {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return t.In(loc).Format(time.RFC3339)
+}
+
+// objectAge is the time since an object was created, formatted like the AGE
+// column of kubectl.
+func objectAge(item *unstructured.Unstructured) string {
+	created := item.GetCreationTimestamp()
+	if created.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(time.Since(created.Time))
+}
+
+// readyStatus is the ready/total count of a pod's containers or of a
+// workload's replicas, <none> for other resources.
+func readyStatus(rec resourceRecord) string {
+	obj := rec.Item.Object
+	switch {
+	case rec.GVR.Group == "" && rec.GVR.Resource == "pods":
+		statuses, _, _ := unstructured.NestedSlice(obj, "status", "containerStatuses")
+		containers, _, _ := unstructured.NestedSlice(obj, "spec", "containers")
+		ready := 0
+		for _, status := range statuses {
+			if s, ok := status.(map[string]interface{}); ok && s["ready"] == true {
+				ready++
+			}
+		}
+		return fmt.Sprintf("%d/%d", ready, len(containers))
+	case rec.GVR.Group == "apps" && (rec.GVR.Resource == "deployments" || rec.GVR.Resource == "statefulsets" || rec.GVR.Resource == "replicasets"):
+		ready, _, _ := unstructured.NestedInt64(obj, "status", "readyReplicas")
+		desired, found, _ := unstructured.NestedInt64(obj, "spec", "replicas")
+		if !found {
+			desired = 1
+		}
+		return fmt.Sprintf("%d/%d", ready, desired)
+	case rec.GVR.Group == "apps" && rec.GVR.Resource == "daemonsets":
+		ready, _, _ := unstructured.NestedInt64(obj, "status", "numberReady")
+		desired, _, _ := unstructured.NestedInt64(obj, "status", "desiredNumberScheduled")
+		return fmt.Sprintf("%d/%d", ready, desired)
+	}
+	return "<none>"
+}
+
+func (p *tablePrinter) Finish() error { return p.w.Flush() }
+
+// namePrinter writes kind.group/name per object, like kubectl -o name.
+type namePrinter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (p *namePrinter) Print(rec resourceRecord) error {
+	kind := strings.ToLower(rec.Item.GetKind())
+	if rec.GVR.Group != "" {
+		kind += "." + rec.GVR.Group
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := fmt.Fprintf(p.w, "%s/%s\n", kind, rec.Item.GetName())
+	return err
+}
+
+func (p *namePrinter) Finish() error { return nil }
+
+// templateFuncs are the functions --template can call besides the built-in
+// ones, as in kubectl.
+var templateFuncs = template.FuncMap{
+	"base64decode": func(s string) (string, error) {
+		b, err := base64.StdEncoding.DecodeString(s)
+		return string(b), err
+	},
+}
+
+// parseOutputTemplate parses a --template, which is executed against each
+// object as a map, e.g. {{.metadata.name}}.
+func parseOutputTemplate(text string) (*template.Template, error) {
+	return template.New("output").Funcs(templateFuncs).Parse(text)
+}
+
+// templatePrinter writes each object through a Go template, ending the output
+// of every object with a newline unless the template already does.
+type templatePrinter struct {
+	mu   sync.Mutex
+	w    io.Writer
+	tmpl *template.Template
+}
+
+func (p *templatePrinter) Print(rec resourceRecord) error {
+	var buf bytes.Buffer
+	if err := p.tmpl.Execute(&buf, rec.Item.Object); err != nil {
+		return fmt.Errorf("failed to execute --template on %s/%s: %v", rec.Item.GetKind(), rec.Item.GetName(), err)
+	}
+	if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := buf.WriteTo(p.w)
+	return err
+}
+
+func (p *templatePrinter) Finish() error { return nil }
+
+// parseJSONPath parses a JSONPath template such as {.metadata.name}. Fields
+// missing from an object print nothing, as in kubectl.
+func parseJSONPath(text string) (*jsonpath.JSONPath, error) {
+	jp := jsonpath.New("output").AllowMissingKeys(true)
+	if err := jp.Parse(text); err != nil {
+		return nil, err
+	}
+	return jp, nil
+}
+
+// jsonPathPrinter writes each object through a JSONPath template. Objects are
+// streamed rather than gathered in a List, so the root of the template is
+// the object itself. Like templatePrinter, it ends every object's output
+// with a newline.
+type jsonPathPrinter struct {
+	mu sync.Mutex
+	w  io.Writer
+	jp *jsonpath.JSONPath
+}
+
+func (p *jsonPathPrinter) Print(rec resourceRecord) error {
+	// A JSONPath keeps state while executing, so it runs under the lock too.
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var buf bytes.Buffer
+	if err := p.jp.Execute(&buf, rec.Item.Object); err != nil {
+		return fmt.Errorf("failed to execute JSONPath on %s/%s: %v", rec.Item.GetKind(), rec.Item.GetName(), err)
+	}
+	if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	_, err := buf.WriteTo(p.w)
+	return err
+}
+
+func (p *jsonPathPrinter) Finish() error { return nil }
+
+// sortingPrinter buffers every object and hands them to next, ordered by
+// key, once the collection is done. Ties are broken by kind, namespace, name
+// and resource so the order doesn't depend on which worker finished first.
+type sortingPrinter struct {
+	mu   sync.Mutex
+	next resourcePrinter
+	key  string
+	recs []resourceRecord
+}
+
+func (p *sortingPrinter) Print(rec resourceRecord) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.recs = append(p.recs, rec)
+	return nil
+}
+
+func (p *sortingPrinter) Finish() error {
+	sort.SliceStable(p.recs, func(i, j int) bool {
+		a, b := p.recs[i].Item, p.recs[j].Item
+		switch p.key {
+		case sortByCreationTimestamp:
+			if ta, tb := a.GetCreationTimestamp(), b.GetCreationTimestamp(); !ta.Equal(&tb) {
+				return ta.Before(&tb)
+			}
+		case sortByName:
+			if a.GetName() != b.GetName() {
+				return a.GetName() < b.GetName()
+			}
+		case sortByNamespace:
+			if a.GetNamespace() != b.GetNamespace() {
+				return a.GetNamespace() < b.GetNamespace()
+			}
+		}
+		if a.GetKind() != b.GetKind() {
+			return a.GetKind() < b.GetKind()
+		}
+		if a.GetNamespace() != b.GetNamespace() {
+			return a.GetNamespace() < b.GetNamespace()
+		}
+		if a.GetName() != b.GetName() {
+			return a.GetName() < b.GetName()
+		}
+		return p.recs[i].GVR.String() < p.recs[j].GVR.String()
+	})
+	for _, rec := range p.recs {
+		if err := p.next.Print(rec); err != nil {
+			return err
+		}
+	}
+	return p.next.Finish()
+}
+
+// dedupeScope is a resource of one context, whose objects dedupePrinter
+// tracks across the versions it is listed under.
+type dedupeScope struct {
+	context string
+	gr      schema.GroupResource
+}
+
+// dedupePrinter passes every object to next only the first time it is seen,
+// so a resource served under several versions isn't output twice. Only the
+// resources planned under more than one version are tracked, by the UID of
+// each object until all their versions are listed, so the memory it takes
+// grows with the largest such resource rather than with the cluster.
+type dedupePrinter struct {
+	mu   sync.Mutex
+	next resourcePrinter
+	// pending counts the versions of every tracked resource left to list.
+	pending map[dedupeScope]int
+	seen    map[dedupeScope]map[string]bool
+}
+
+// plan tracks the resources of kubeContext that jobs list under more than
+// one version.
+func (p *dedupePrinter) plan(kubeContext string, jobs []listJob) {
+	if p == nil {
+		return
+	}
+	versions := make(map[dedupeScope]int)
+	for _, job := range jobs {
+		versions[dedupeScope{kubeContext, job.gvr.GroupResource()}]++
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for scope, n := range versions {
+		if n < 2 {
+			continue
+		}
+		p.pending[scope] += n
+		if p.seen[scope] == nil {
+			p.seen[scope] = make(map[string]bool)
+		}
+	}
+}
+
+// listed counts a version of a resource as listed, dropping the objects
+// seen of a tracked resource once its last version is.
+func (p *dedupePrinter) listed(kubeContext string, gvr schema.GroupVersionResource) {
+	if p == nil {
+		return
+	}
+	scope := dedupeScope{kubeContext, gvr.GroupResource()}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.pending[scope]; !ok {
+		return
+	}
+	if p.pending[scope]--; p.pending[scope] == 0 {
+		delete(p.pending, scope)
+		delete(p.seen, scope)
+	}
+}
+
+func (p *dedupePrinter) Print(rec resourceRecord) error {
+	scope := dedupeScope{rec.Context, rec.GVR.GroupResource()}
+	key := listedObjectKey(rec.Item)
+	p.mu.Lock()
+	if seen := p.seen[scope]; seen != nil {
+		if seen[key] {
+			p.mu.Unlock()
+			return nil
+		}
+		seen[key] = true
+	}
+	p.mu.Unlock()
+	return p.next.Print(rec)
+}
+
+func (p *dedupePrinter) Finish() error { return p.next.Finish() }
+
+// ownerSelector names the object of --owned-by. kind is matched
+// case-insensitively and the name in every namespace.
+type ownerSelector struct {
+	kind string
+	name string
+}
+
+// ownedByPrinter buffers every object and, once the collection is done, hands
+// next the selected owner and every object whose owner references lead to it.
+type ownedByPrinter struct {
+	mu    sync.Mutex
+	next  resourcePrinter
+	owner ownerSelector
+	recs  []resourceRecord
+}
+
+func (p *ownedByPrinter) Print(rec resourceRecord) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.recs = append(p.recs, rec)
+	return nil
+}
+
+func (p *ownedByPrinter) Finish() error {
+	dependents := make(map[types.UID][]types.UID)
+	var queue []types.UID
+	for _, rec := range p.recs {
+		item := rec.Item
+		for _, ref := range item.GetOwnerReferences() {
+			dependents[ref.UID] = append(dependents[ref.UID], item.GetUID())
+		}
+		if strings.EqualFold(item.GetKind(), p.owner.kind) && item.GetName() == p.owner.name {
+			queue = append(queue, item.GetUID())
+		}
+	}
+	keep := make(map[types.UID]bool)
+	for len(queue) > 0 {
+		uid := queue[0]
+		queue = queue[1:]
+		if keep[uid] {
+			continue
+		}
+		keep[uid] = true
+		queue = append(queue, dependents[uid]...)
+	}
+
+	for _, rec := range p.recs {
+		if !keep[rec.Item.GetUID()] {
+			continue
+		}
+		if err := p.next.Print(rec); err != nil {
+			return err
+		}
+	}
+	return p.next.Finish()
+}
+
+// statsPrinter counts the objects that reach next for the run summary.
+type statsPrinter struct {
+	next resourcePrinter
+}
+
+func (p *statsPrinter) Print(rec resourceRecord) error {
+	if err := p.next.Print(rec); err != nil {
+		return err
+	}
+	summary.addObject(rec.GVR.Group)
+	return nil
+}
+
+func (p *statsPrinter) Finish() error { return p.next.Finish() }
+
+// countingWriter adds the bytes written through it to the run summary.
+type countingWriter struct {
+	w io.Writer
+}
+
+func (c countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	summary.addBytes(n)
+	return n, err
+}
+
+// nopPrinter discards everything, for runs that don't output objects.
+type nopPrinter struct{}
+
+func (nopPrinter) Print(resourceRecord) error { return nil }
+func (nopPrinter) Finish() error              { return nil }
+
+// countPrinter tallies objects per resource type and prints the totals,
+// sorted by resource, once the collection is done.
+type countPrinter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	counts map[schema.GroupVersionResource]int
+}
+
+func (p *countPrinter) Print(rec resourceRecord) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.counts[rec.GVR]++
+	return nil
+}
+
+func (p *countPrinter) Finish() error {
+	lines := make([]string, 0, len(p.counts))
+	total := 0
+	for gvr, n := range p.counts {
+		lines = append(lines, fmt.Sprintf("%s: %d", describeGVR(gvr), n))
+		total += n
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(p.w, line); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(p.w, "total: %d\n", total)
+	return err
+}
+
+func writeYAML(raw []byte, w io.Writer) {
+	y := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(raw), 1024)
+	var obj map[string]interface{}
+	_ = y.Decode(&obj)
+
+	scheme := runtime.NewScheme()
+	serializer := jsonserializer.NewYAMLSerializer(jsonserializer.DefaultMetaFactory, scheme, scheme)
+
+	contentType := runtime.ContentTypeYAML
+	if isJSON(raw) {
+		contentType = runtime.ContentTypeJSON
+	}
+
+	unstructuredObj := &runtime.Unknown{Raw: raw, ContentType: contentType}
+	_ = serializer.Encode(unstructuredObj, w)
+}
+
+func isJSON(data []byte) bool {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func testRecord(gvr schema.GroupVersionResource, kind, namespace, name string) resourceRecord {
+	item := &unstructured.Unstructured{}
+	item.SetAPIVersion(gvr.GroupVersion().String())
+	item.SetKind(kind)
+	item.SetNamespace(namespace)
+	item.SetName(name)
+	return resourceRecord{Item: item, GVR: gvr}
+}
+
+var (
+	nodesGVR       = schema.GroupVersionResource{Version: "v1", Resource: "nodes"}
+	podsGVR        = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	deploymentsGVR = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+)
+
+func TestObjectPath(t *testing.T) {
+	inContext := testRecord(nodesGVR, "Node", "", "worker-0")
+	inContext.Context = "prod"
+
+	layout, err := parsePathTemplate("{{.Namespace}}/{{.Kind}}/{{.Name}}.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		rec    resourceRecord
+		layout *template.Template
+		want   string
+	}{
+		{"node", testRecord(nodesGVR, "Node", "", "worker-0"), nil, "_cluster/nodes/worker-0.yaml"},
+		{"namespace", testRecord(namespacesGVR, "Namespace", "", "default"), nil, "_cluster/namespaces/default.yaml"},
+		{"pod", testRecord(podsGVR, "Pod", "default", "web-0"), nil, "default/pods/web-0.yaml"},
+		{"deployment", testRecord(deploymentsGVR, "Deployment", "default", "web"), nil, "default/deployments.apps/web.yaml"},
+		{"context", inContext, nil, "prod/_cluster/nodes/worker-0.yaml"},
+		{"unsafe name", testRecord(podsGVR, "Pod", "default", "a:b"), nil, "default/pods/a_b.yaml"},
+		{"layout, node", testRecord(nodesGVR, "Node", "", "worker-0"), layout, "_cluster/Node/worker-0.yaml"},
+		{"layout, pod", testRecord(podsGVR, "Pod", "default", "web-0"), layout, "default/Pod/web-0.yaml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := objectPath(tt.rec, tt.layout)
+			if err != nil {
+				t.Fatalf("objectPath: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("objectPath = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDirPrinter(t *testing.T) {
+	dir := t.TempDir()
+	p, err := newDirPrinter(dir, nil, false, false, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range []resourceRecord{
+		testRecord(nodesGVR, "Node", "", "worker-0"),
+		testRecord(namespacesGVR, "Namespace", "", "default"),
+		testRecord(podsGVR, "Pod", "default", "web-0"),
+	} {
+		if err := p.Print(rec); err != nil {
+			t.Fatalf("Print: %v", err)
+		}
+	}
+	if err := p.Finish(); err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+
+	for _, rel := range []string{
+		indexFileName,
+		"_cluster/nodes/worker-0.yaml",
+		"_cluster/namespaces/default.yaml",
+		"default/pods/web-0.yaml",
+	} {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(rel))); err != nil {
+			t.Errorf("missing %s: %v", rel, err)
+		}
+	}
+	rows, err := readIndex(filepath.Join(dir, indexFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("index has %d rows, want 3", len(rows))
+	}
+	if rows[0][4] != "_cluster/nodes/worker-0.yaml" {
+		t.Errorf("index path of the node = %q, want _cluster/nodes/worker-0.yaml", rows[0][4])
+	}
+}
+
+// TestPrintersOnlyWriteOutput checks that objects go to the writer printers
+// are given while warnings and progress go through log, so stdout can be piped
+// with the diagnostics on stderr.
+func TestPrintersOnlyWriteOutput(t *testing.T) {
+	defer log.SetOutput(os.Stderr)
+	defer func(level verbosity) { logLevel = level }(logLevel)
+	logLevel = logSkipped
+
+	started := testRecord(podsGVR, "Pod", "default", "web-0").Item
+	if err := unstructured.SetNestedField(started.Object, "2025-08-10T09:39:09Z", "status", "startTime"); err != nil {
+		t.Fatal(err)
+	}
+	pending := testRecord(podsGVR, "Pod", "default", "pending-0").Item
+
+	for _, format := range []string{formatCSV, formatTable, formatName, formatJSONL} {
+		t.Run(format, func(t *testing.T) {
+			var out, logged bytes.Buffer
+			progress := startProgress(&logged)
+			log.SetOutput(progress)
+			progress.addPlanned(1)
+			progress.listing("pods")
+			progress.draw()
+
+			filter := ResourceFilter{
+				OutputFormat: format,
+				Columns:      defaultCSVColumns,
+				After:        time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+				TimeField:    []string{"status", "startTime"},
+			}
+			printer, err := newPrinter(context.Background(), filter, &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			items := []unstructured.Unstructured{*started.DeepCopy(), *pending.DeepCopy()}
+			filterAndOutput(items, podsGVR, filter, printer)
+			log.Printf("Warning: a warning")
+			progress.listed()
+			if err := printer.Finish(); err != nil {
+				t.Fatal(err)
+			}
+			progress.finish()
+			log.SetOutput(os.Stderr)
+
+			if !strings.Contains(out.String(), "web-0") {
+				t.Errorf("output %q lacks the object", out.String())
+			}
+			for _, diagnostic := range []string{"Skipping", "Warning", "[0/1]", "\r"} {
+				if strings.Contains(out.String(), diagnostic) {
+					t.Errorf("output %q holds the diagnostic %q", out.String(), diagnostic)
+				}
+				if !strings.Contains(logged.String(), diagnostic) {
+					t.Errorf("log %q lacks the diagnostic %q", logged.String(), diagnostic)
+				}
+			}
+			if strings.Contains(logged.String(), "web-0") {
+				t.Errorf("log %q holds the output", logged.String())
+			}
+		})
+	}
+}
+
+// recordingPrinter keeps the records it is given.
+type recordingPrinter struct {
+	recs []resourceRecord
+}
+
+func (p *recordingPrinter) Print(rec resourceRecord) error {
+	p.recs = append(p.recs, rec)
+	return nil
+}
+
+func (p *recordingPrinter) Finish() error { return nil }
+
+func TestDedupePrinter(t *testing.T) {
+	deploymentsV1beta2 := deploymentsGVR
+	deploymentsV1beta2.Version = "v1beta2"
+	next := &recordingPrinter{}
+	printer, err := newPrinter(context.Background(), ResourceFilter{}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := printer.(*dedupePrinter)
+	p.next = next
+	p.plan("", []listJob{{gvr: deploymentsGVR}, {gvr: deploymentsV1beta2}, {gvr: podsGVR}})
+	if len(p.seen) != 1 {
+		t.Fatalf("tracking %d resources, want only deployments", len(p.seen))
+	}
+
+	record := func(gvr schema.GroupVersionResource, kind, name, uid string) resourceRecord {
+		rec := testRecord(gvr, kind, "default", name)
+		rec.Item.SetUID(types.UID(uid))
+		return rec
+	}
+	for _, rec := range []resourceRecord{
+		record(deploymentsGVR, "Deployment", "web", "1"),
+		record(deploymentsV1beta2, "Deployment", "web", "1"),
+		record(deploymentsV1beta2, "Deployment", "api", "2"),
+		record(podsGVR, "Pod", "web-0", "3"),
+		record(podsGVR, "Pod", "web-0", "3"),
+	} {
+		if err := p.Print(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	for _, rec := range next.recs {
+		got = append(got, rec.GVR.Version+" "+rec.Item.GetName())
+	}
+	want := []string{"v1 web", "v1beta2 api", "v1 web-0", "v1 web-0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+
+	p.listed("", podsGVR)
+	p.listed("", deploymentsGVR)
+	if len(p.seen) != 1 {
+		t.Errorf("dropped deployments before all their versions were listed")
+	}
+	p.listed("", deploymentsV1beta2)
+	if len(p.seen) != 0 || len(p.pending) != 0 {
+		t.Errorf("still tracking %d resources after they were listed", len(p.seen))
+	}
+}
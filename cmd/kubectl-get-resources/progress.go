@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// progress is the indicator of an interactive run, nil otherwise.
+var progress *progressIndicator
+
+// progressIndicator keeps a spinner line on a terminal showing the resource
+// type being listed, how many of the planned types are done and the objects
+// collected so far. It is also the log output while it runs, clearing its
+// line before every log message so the two don't interleave.
+type progressIndicator struct {
+	mu      sync.Mutex
+	out     io.Writer
+	current string
+	done    int
+	total   int
+	frame   int
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// progressFrames are the spinner frames, drawn in turn.
+var progressFrames = []string{"|", "/", "-", "\\"}
+
+const progressInterval = 100 * time.Millisecond
+
+// startProgress starts drawing the indicator on out until stop is called.
+func startProgress(out io.Writer) *progressIndicator {
+	p := &progressIndicator{out: out, stop: make(chan struct{}), stopped: make(chan struct{})}
+	go func() {
+		defer close(p.stopped)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.draw()
+			}
+		}
+	}()
+	return p
+}
+
+// isTerminal reports whether f is a terminal rather than a file or a pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (p *progressIndicator) draw() {
+	objects := summary.objectCount()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.frame = (p.frame + 1) % len(progressFrames)
+	fmt.Fprintf(p.out, "\r\033[K%s [%d/%d] %d objects  %s", progressFrames[p.frame], p.done, p.total, objects, p.current)
+}
+
+// Write clears the indicator line and writes b, a log message, in its place.
+// The indicator is drawn again on the next tick.
+func (p *progressIndicator) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprint(p.out, "\r\033[K")
+	return p.out.Write(b)
+}
+
+// addPlanned adds n resource types to the total to list.
+func (p *progressIndicator) addPlanned(n int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total += n
+}
+
+// listing shows the resource type now being listed.
+func (p *progressIndicator) listing(resource string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current = resource
+}
+
+// listed counts a planned resource type as done.
+func (p *progressIndicator) listed() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+}
+
+// finish stops the indicator and clears its line.
+func (p *progressIndicator) finish() {
+	if p == nil {
+		return
+	}
+	close(p.stop)
+	<-p.stopped
+	fmt.Fprint(p.out, "\r\033[K")
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/managedfields"
+	"k8s.io/client-go/discovery"
+	"k8s.io/kube-openapi/pkg/util/proto"
+)
+
+// objectValidator checks objects against the OpenAPI schema published by
+// the cluster they were collected from, for --validate.
+type objectValidator struct {
+	parser *managedfields.GvkParser
+}
+
+// newObjectValidator fetches the OpenAPI schema of the cluster. It covers
+// the built-in kinds and the custom resources with a structural schema.
+func newObjectValidator(disc discovery.DiscoveryInterface) (*objectValidator, error) {
+	doc, err := disc.OpenAPISchema()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the OpenAPI schema: %v", err)
+	}
+	models, err := proto.NewOpenAPIData(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the OpenAPI schema: %v", err)
+	}
+	parser, err := managedfields.NewGVKParser(models, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the OpenAPI schema: %v", err)
+	}
+	return &objectValidator{parser: parser}, nil
+}
+
+// validate returns why item doesn't conform to the schema of its kind, e.g.
+// a field the schema doesn't declare or a value of the wrong type. Kinds
+// without a schema pass.
+func (v *objectValidator) validate(item *unstructured.Unstructured) error {
+	t := v.parser.Type(item.GroupVersionKind())
+	if t == nil {
+		return nil
+	}
+	_, err := t.FromUnstructured(item.Object)
+	return err
+}
+
+// reportInvalid logs an object that doesn't conform to its schema and
+// records it in the error log. The object is still output.
+func reportInvalid(item *unstructured.Unstructured, gvr schema.GroupVersionResource, kubeContext string, err error) {
+	name := item.GetName()
+	if item.GetNamespace() != "" {
+		name = item.GetNamespace() + "/" + name
+	}
+	log.Printf("Warning: %s %s doesn't conform to its schema: %v", describeGVR(gvr), name, err)
+	errorLog.record(errorLogEntry{Operation: "validate", Context: kubeContext, Group: gvr.Group, Version: gvr.Version, Resource: gvr.Resource, Namespace: item.GetNamespace(), Name: item.GetName()}, err)
+}
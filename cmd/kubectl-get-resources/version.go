@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// version, commit and date are set by the release build through -ldflags -X.
+// Other builds fall back to what the Go toolchain records in the binary.
+var (
+	version = ""
+	commit  = ""
+	date    = ""
+)
+
+// versionString describes the build for --version.
+func versionString() string {
+	v, c, d := version, commit, date
+	dirty := false
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			v = info.Main.Version
+		}
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && c == "":
+				c = setting.Value
+			case setting.Key == "vcs.time" && d == "":
+				d = setting.Value
+			case setting.Key == "vcs.modified" && commit == "":
+				dirty = setting.Value == "true"
+			}
+		}
+	}
+	if dirty && c != "" {
+		c += "-dirty"
+	}
+	if v == "" {
+		v = "dev"
+	}
+	if c == "" {
+		c = "unknown"
+	}
+	if d == "" {
+		d = "unknown"
+	}
+	return fmt.Sprintf("%s (commit %s, built %s, %s %s/%s)", v, c, d, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+)
+
+// watchTarget is a single watch: a resource type, cluster-wide or in one
+// namespace.
+type watchTarget struct {
+	gvr   schema.GroupVersionResource
+	ri    dynamic.ResourceInterface
+	scope string
+}
+
+// watchResources watches every planned resource type, in the requested
+// namespaces for namespaced resources, and outputs the objects added or
+// modified until ctx is done. Unlike listing, every watch needs its own
+// goroutine for the whole run, so --workers doesn't apply.
+func watchResources(ctx context.Context, dyn dynamic.Interface, jobs []listJob, filter ResourceFilter, namespaces []string, printer resourcePrinter) {
+	var targets []watchTarget
+	for _, job := range jobs {
+		switch {
+		case !job.namespaced:
+			targets = append(targets, watchTarget{job.gvr, dyn.Resource(job.gvr), ""})
+		case namespaces == nil || (len(namespaces) == 1 && namespaces[0] == "*"):
+			targets = append(targets, watchTarget{job.gvr, dyn.Resource(job.gvr).Namespace(metav1.NamespaceAll), " in all namespaces"})
+		default:
+			for _, ns := range namespaces {
+				targets = append(targets, watchTarget{job.gvr, dyn.Resource(job.gvr).Namespace(ns), " in namespace " + ns})
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			watchResource(ctx, target, filter, printer)
+		}()
+	}
+	wg.Wait()
+}
+
+// watchResource outputs the current objects of target as they are sent by
+// the initial watch, then every object added or modified. A watch closed by
+// the apiserver is resumed from the last resourceVersion seen; once that has
+// expired it is started over, which outputs the current objects again.
+func watchResource(ctx context.Context, target watchTarget, filter ResourceFilter, printer resourcePrinter) {
+	resourceVersion := ""
+	failures := 0
+	for ctx.Err() == nil {
+		opts := listOptions(filter)
+		opts.Limit = 0
+		opts.ResourceVersion = resourceVersion
+		opts.AllowWatchBookmarks = true
+		vlogf(logProgress, "Watching %s%s from resourceVersion %q", describeGVR(target.gvr), target.scope, resourceVersion)
+		w, err := target.ri.Watch(ctx, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+				log.Printf("Warning: resourceVersion of %s%s expired, restarting the watch: %v", describeGVR(target.gvr), target.scope, err)
+				resourceVersion = ""
+				continue
+			}
+			if !isRetryable(err) || failures >= filter.MaxRetries {
+				reportListError(target.gvr, target.scope, filter.Context, err)
+				return
+			}
+			delay := min(retryBaseDelay<<failures, retryMaxDelay)
+			failures++
+			vlogf(logSkipped, "Retrying Watch in %s (attempt %d of %d): %v", delay, failures, filter.MaxRetries, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			continue
+		}
+		failures = 0
+		resourceVersion = consumeWatch(w, target, filter, printer, resourceVersion)
+	}
+}
+
+// consumeWatch outputs the objects of w's events until it is closed and
+// returns the resourceVersion to resume from, empty if it has expired.
+func consumeWatch(w watch.Interface, target watchTarget, filter ResourceFilter, printer resourcePrinter, resourceVersion string) string {
+	defer w.Stop()
+	for event := range w.ResultChan() {
+		if event.Type == watch.Error {
+			err := apierrors.FromObject(event.Object)
+			if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+				log.Printf("Warning: resourceVersion of %s%s expired, restarting the watch: %v", describeGVR(target.gvr), target.scope, err)
+				return ""
+			}
+			vlogf(logSkipped, "Watch of %s%s failed, resuming: %v", describeGVR(target.gvr), target.scope, err)
+			return resourceVersion
+		}
+
+		item, ok := event.Object.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		resourceVersion = item.GetResourceVersion()
+		if event.Type == watch.Added || event.Type == watch.Modified {
+			filterAndOutput([]unstructured.Unstructured{*item}, target.gvr, filter, printer)
+		}
+	}
+	return resourceVersion
+}